@@ -0,0 +1,463 @@
+package gotcha
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+const (
+	aofSet uint8 = iota + 1
+	aofDelete
+	aofClear
+	aofExpire
+)
+
+const (
+	// aofFrameHeaderSize is the size of the payload length and checksum before every record
+	aofFrameHeaderSize = 4 + 4
+	// aofSyncInterval is the interval of syncing with AOFSyncEverySecond and checking the rewrite
+	aofSyncInterval = time.Second
+)
+
+// aofRecord is the write logged to the append only file
+type aofRecord struct {
+	Op         uint8
+	Key        string        `json:",omitempty"`
+	Value      interface{}   `json:",omitempty"`
+	Data       []byte        `json:",omitempty"` // the value encoded by the codec of the cache, instead of Value
+	StoredTime int64         `json:",omitempty"`
+	TTL        time.Duration `json:",omitempty"`
+	Delta      time.Duration `json:",omitempty"`
+	Tags       []string      `json:",omitempty"`
+}
+
+// appendOnlyFile logs the writes as the frames of the payload length, the checksum, and the record
+// encoded with the snapshot codec, so a torn write at the end of the file is detected on replay
+type appendOnlyFile struct {
+	mutex        sync.Mutex
+	rewriteMutex sync.Mutex // serializes the rewrites
+	file         *os.File
+	path         string
+	codec        cache.SnapshotCodec
+	policy       cache.AOFSyncPolicy
+	size         uint64
+	baseSize     uint64   // the size after the last rewrite
+	dirty        bool     // written since the last sync
+	rewriting    bool     // the frames are buffered for the rewritten file
+	pending      [][]byte // the frames appended since the records of the rewrite are collected
+}
+
+// openAOF opens the file for appending, the file must be replayed before
+func openAOF(path string, codec cache.SnapshotCodec, policy cache.AOFSyncPolicy) (aof *appendOnlyFile, err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return
+	}
+	aof = &appendOnlyFile{
+		file:     file,
+		path:     path,
+		codec:    codec,
+		policy:   policy,
+		size:     uint64(info.Size()),
+		baseSize: uint64(info.Size()),
+	}
+	return
+}
+
+// encodeFrame encodes the record as a frame with a new encoder, since the file is appended across restarts
+func encodeFrame(codec cache.SnapshotCodec, record *aofRecord) (frame []byte, err error) {
+	buf := bytes.NewBuffer(make([]byte, aofFrameHeaderSize))
+	if err = codec.NewEncoder(buf).Encode(record); err != nil {
+		return
+	}
+	frame = buf.Bytes()
+	payload := frame[aofFrameHeaderSize:]
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(payload, crcTable))
+	return
+}
+
+// append writes the record, it's a no-op if the append only file is disabled or closed
+func (a *appendOnlyFile) append(record *aofRecord) (err error) {
+	if a == nil {
+		return
+	}
+	frame, err := encodeFrame(a.codec, record)
+	if err != nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil {
+		return
+	}
+	if _, err = a.file.Write(frame); err != nil {
+		return
+	}
+	if a.rewriting {
+		a.pending = append(a.pending, frame)
+	}
+	a.size += uint64(len(frame))
+	if a.policy == cache.AOFSyncAlways {
+		return a.file.Sync()
+	}
+	a.dirty = true
+	return
+}
+
+// sync flushes the written records to the disk with AOFSyncEverySecond
+func (a *appendOnlyFile) sync() (err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil || !a.dirty || a.policy != cache.AOFSyncEverySecond {
+		return
+	}
+	a.dirty = false
+	return a.file.Sync()
+}
+
+// needRewrite checks if the file reaches the minimum size and doubles since the last rewrite
+func (a *appendOnlyFile) needRewrite(minSize uint64) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.file != nil && a.size >= minSize && a.size >= 2*a.baseSize
+}
+
+// startRewrite buffers the frames appended from now on, until the rewrite is done
+func (a *appendOnlyFile) startRewrite() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rewriting = true
+	a.pending = nil
+}
+
+// stopRewrite drops the buffered frames
+func (a *appendOnlyFile) stopRewrite() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rewriting = false
+	a.pending = nil
+}
+
+// rewrite replaces the file atomically with the given records followed by the frames appended since
+// startRewrite, and appends the next records to the new file
+func (a *appendOnlyFile) rewrite(records []aofRecord) (err error) {
+	defer a.stopRewrite()
+	dir := filepath.Dir(a.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(a.path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	var size uint64
+	for i := range records {
+		frame, err := encodeFrame(a.codec, &records[i])
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(frame); err != nil {
+			return err
+		}
+		size += uint64(len(frame))
+	}
+	if err = w.Flush(); err != nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil {
+		return os.ErrClosed
+	}
+	for _, frame := range a.pending {
+		if _, err = tmp.Write(frame); err != nil {
+			return
+		}
+		size += uint64(len(frame))
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), a.path); err != nil {
+		return
+	}
+	syncDir(dir)
+	_ = a.file.Close()
+	a.file = tmp
+	a.size, a.baseSize = size, size
+	a.dirty = false
+	return
+}
+
+// close syncs and closes the file, the next records are ignored
+func (a *appendOnlyFile) close() (err error) {
+	if a == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil {
+		return
+	}
+	err = a.file.Sync()
+	if errClose := a.file.Close(); err == nil {
+		err = errClose
+	}
+	a.file = nil
+	return
+}
+
+// replayAOF applies the records of the append only file. A torn record at the end of the file
+// left by a crash is truncated, since it was never acknowledged as durable with AOFSyncAlways.
+// A corrupted record in the middle of the file returns cache.ErrSnapshotCorrupted and leaves the file
+func (c *Cache) replayAOF(path string) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r := bufio.NewReader(file)
+	var offset int64
+	header := make([]byte, aofFrameHeaderSize)
+	for {
+		if _, err = io.ReadFull(r, header); err != nil {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		if offset+aofFrameHeaderSize+length > info.Size() {
+			err = io.ErrUnexpectedEOF
+			break
+		}
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if binary.BigEndian.Uint32(header[4:]) != crc32.Checksum(payload, crcTable) {
+			if offset+aofFrameHeaderSize+length < info.Size() {
+				return cache.ErrSnapshotCorrupted
+			}
+			err = io.ErrUnexpectedEOF
+			break
+		}
+
+		var record aofRecord
+		if err = c.option.SnapshotCodec.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return
+		}
+		if record.Value, err = c.restoreValue(record.Value, record.Data); err != nil {
+			return
+		}
+		if err = c.apply(&record); err != nil {
+			return
+		}
+		offset += int64(aofFrameHeaderSize + len(payload))
+	}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return os.Truncate(path, offset)
+	}
+	return
+}
+
+// apply applies the record without logging it. The caller must hold the lock
+func (c *Cache) apply(record *aofRecord) (err error) {
+	switch record.Op {
+	case aofSet:
+		doc := c.newDocument(record.Key, record.Value)
+		doc.StoredTime = record.StoredTime
+		doc.TTL = record.TTL
+		doc.Delta = record.Delta
+		doc.Tags = record.Tags
+		if doc.IsExpired() {
+			_, err = c.remove(record.Key)
+			return
+		}
+		return c.store(doc)
+	case aofDelete:
+		_, err = c.remove(record.Key)
+	case aofClear:
+		err = c.clear()
+	case aofExpire:
+		// The item may be evicted since
+		_ = c.repo.SetTTL(record.Key, record.StoredTime, record.TTL)
+	}
+	return
+}
+
+// logSet logs the document stored to the repository, unless it's evicted right away
+func (c *Cache) logSet(doc *cache.Document) (err error) {
+	if c.aof == nil {
+		return
+	}
+	// Compare the versions, since the repository may return a copy of the document
+	if stored, errPeek := c.repo.PeekMetadata(doc.Key); errPeek != nil || stored.Version != doc.Version {
+		return
+	}
+	value, data, err := c.persistValue(doc.Value)
+	if err != nil {
+		return
+	}
+	return c.aof.append(&aofRecord{
+		Op:         aofSet,
+		Key:        doc.Key,
+		Value:      value,
+		Data:       data,
+		StoredTime: doc.StoredTime,
+		TTL:        doc.TTL,
+		Delta:      doc.Delta,
+		Tags:       doc.Tags,
+	})
+}
+
+// logDelete logs the document removed from the repository, the replaced document is not logged
+// since the new document is logged by logSet
+func (c *Cache) logDelete(doc *cache.Document) {
+	if c.aof == nil || c.repo.Contains(doc.Key) {
+		return
+	}
+	if err := c.aof.append(&aofRecord{Op: aofDelete, Key: doc.Key}); err != nil {
+		c.aofError(err)
+	}
+}
+
+// logExpire logs the new expiry time of the document
+func (c *Cache) logExpire(doc *cache.Document) (err error) {
+	return c.aof.append(&aofRecord{Op: aofExpire, Key: doc.Key, StoredTime: doc.StoredTime, TTL: doc.TTL})
+}
+
+// logClear logs clearing all the items
+func (c *Cache) logClear() (err error) {
+	return c.aof.append(&aofRecord{Op: aofClear})
+}
+
+func (c *Cache) aofError(err error) {
+	if c.option.OnAOFError != nil {
+		c.option.OnAOFError(err)
+	}
+}
+
+// RewriteAOF will rewrite the append only file with the current items, including the items in the disk tier,
+// so the file doesn't grow forever.
+// It's done in background when the file doubles since the last rewrite and reaches the AOFRewriteSize.
+// The items are collected under the lock, then the file is written while the writes are buffered
+func (c *Cache) RewriteAOF() (err error) {
+	if c.aof == nil {
+		return
+	}
+	c.aof.rewriteMutex.Lock()
+	defer c.aof.rewriteMutex.Unlock()
+
+	var records []aofRecord
+	collect := func(doc *cache.Document) bool {
+		if doc.IsExpired() {
+			return true
+		}
+		records = append(records, aofRecord{
+			Op:         aofSet,
+			Key:        doc.Key,
+			Value:      doc.Value,
+			StoredTime: doc.StoredTime,
+			TTL:        doc.TTL,
+			Delta:      doc.Delta,
+			Tags:       doc.Tags,
+		})
+		return true
+	}
+	// Read lock, since the writes are logged under the write lock
+	c.mutex.RLock()
+	c.rangeSpilled(collect)
+	c.repo.Range(collect)
+	c.aof.startRewrite()
+	c.mutex.RUnlock()
+
+	for i := range records {
+		if records[i].Value, records[i].Data, err = c.persistValue(records[i].Value); err != nil {
+			c.aof.stopRewrite()
+			return
+		}
+	}
+	return c.aof.rewrite(records)
+}
+
+// startAOF replays the append only file, or loads the snapshot if the append only file doesn't exist,
+// and syncs and rewrites the file in background until Close. The file isn't appended if the replay fails,
+// since the records appended after the failed one could never be replayed
+func (c *Cache) startAOF() {
+	_, err := os.Stat(c.option.AOFPath)
+	exists := err == nil
+	if exists {
+		if err = c.replayAOF(c.option.AOFPath); err != nil {
+			c.aofError(err)
+			return
+		}
+	} else {
+		c.loadSnapshot()
+	}
+
+	c.aof, err = openAOF(c.option.AOFPath, c.option.SnapshotCodec, c.option.AOFSync)
+	if err != nil {
+		c.aofError(err)
+		return
+	}
+	if !exists {
+		// Log the items loaded from the snapshot
+		if err = c.RewriteAOF(); err != nil {
+			c.aofError(err)
+		}
+	}
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		ticker := time.NewTicker(aofSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.aof.sync(); err != nil {
+					c.aofError(err)
+				}
+				if c.aof.needRewrite(c.option.AOFRewriteSize) {
+					if err := c.RewriteAOF(); err != nil {
+						c.aofError(err)
+					}
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,344 @@
+package gotcha_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func newAOFOption(t *testing.T, path string) *cache.Option {
+	return gotcha.NewOption().SetAppendOnlyFile(path, cache.AOFSyncAlways).SetOnAOFError(func(err error) {
+		t.Errorf("expected: %v, got %v", nil, err)
+	})
+}
+
+func TestAOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path))
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	err := c.Delete("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Persist("key-3")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.Increment("counter", 2)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// Crash without closing, the writes are synced with AOFSyncAlways
+
+	restored := gotcha.New(newAOFOption(t, path))
+	defer restored.Close()
+	keys, err := restored.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	sort.Strings(keys)
+	expected := []string{"counter", "key-1", "key-3"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected: %v, got %v", expected, keys)
+	}
+	ttl, err := restored.TTL("key-3")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if ttl != cache.NoExpiration {
+		t.Fatalf("expected: %v, got %v", cache.NoExpiration, ttl)
+	}
+	val, err := restored.Get("counter")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != int64(2) {
+		t.Fatalf("expected: %v, got %v", 2, val)
+	}
+}
+
+func TestAOFReplayClearCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path))
+	err := c.Set("key-1", "key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.ClearCache()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Set("key-2", "key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New(newAOFOption(t, path))
+	defer restored.Close()
+	keys, err := restored.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"key-2"}) {
+		t.Fatalf("expected: %v, got %v", []string{"key-2"}, keys)
+	}
+}
+
+func TestAOFTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path))
+	err := c.Set("key-1", "key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The crash in the middle of the write leaves a partial record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = f.Write([]byte{0, 0, 1, 0, 42})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_ = f.Close()
+
+	// The partial record is truncated, so the next writes are appended after the last complete record
+	restored := gotcha.New(newAOFOption(t, path))
+	err = restored.Set("key-2", "key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = restored.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored = gotcha.New(newAOFOption(t, path))
+	defer restored.Close()
+	keys, err := restored.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"key-1", "key-2"}) {
+		t.Fatalf("expected: %v, got %v", []string{"key-1", "key-2"}, keys)
+	}
+}
+
+func TestAOFCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path))
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	err := c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// Flip a byte in the payload of the first record
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	data[10] ^= 0xff
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	var errs []error
+	restored := gotcha.New(gotcha.NewOption().SetAppendOnlyFile(path, cache.AOFSyncAlways).SetOnAOFError(func(err error) {
+		errs = append(errs, err)
+	}))
+	if len(errs) != 1 || !errors.Is(errs[0], cache.ErrSnapshotCorrupted) {
+		t.Fatalf("expected: %v, got %v", []error{cache.ErrSnapshotCorrupted}, errs)
+	}
+	// The file is not appended, so the records after the corrupted one are not lost
+	err = restored.Set("key-4", "key-4")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = restored.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !bytes.Equal(stored, data) {
+		t.Fatalf("expected: %v, got %v", len(data), len(stored))
+	}
+}
+
+func TestRewriteAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path))
+	for i := 0; i < 100; i++ {
+		err := c.Set("key-1", i)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	err = c.RewriteAOF()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("expected: %v, got %v", "smaller than "+before.Name(), after.Size())
+	}
+
+	// The writes after the rewrite are appended to the new file
+	err = c.Set("key-2", "key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New(newAOFOption(t, path))
+	defer restored.Close()
+	val, err := restored.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != 99 {
+		t.Fatalf("expected: %v, got %v", 99, val)
+	}
+	if !restored.Contains("key-2") {
+		t.Fatalf("expected: %v, got %v", "key-2", "missing")
+	}
+}
+
+func TestRewriteAOFConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path).SetMaxSizeItem(1000))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := c.Set(fmt.Sprintf("key-%d", i), i); err != nil {
+				t.Errorf("expected: %v, got %v", nil, err)
+			}
+		}
+	}()
+	// The writes during the rewrite are appended to the rewritten file
+	for i := 0; i < 10; i++ {
+		if err := c.RewriteAOF(); err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	<-done
+	err := c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New(newAOFOption(t, path).SetMaxSizeItem(1000))
+	defer restored.Close()
+	for i := 0; i < 200; i++ {
+		val, err := restored.Get(fmt.Sprintf("key-%d", i))
+		if err != nil || val != i {
+			t.Fatalf("expected: %v, got %v", i, val)
+		}
+	}
+}
+
+func TestAOFBackgroundRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path).SetAOFRewriteSize(1024))
+	defer c.Close()
+	for i := 0; i < 100; i++ {
+		err := c.Set("key-1", i)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	for {
+		after, err := os.Stat(path)
+		if err == nil && after.Size() < before.Size() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected: %v, got %v", "rewritten", "timeout")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func TestAOFWithSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "cache.snapshot")
+	aofPath := filepath.Join(dir, "cache.aof")
+	c := gotcha.New(gotcha.NewOption().SetSnapshotFile(snapshotPath, 0))
+	err := c.Set("key-1", "key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The snapshot is loaded when the append only file doesn't exist, and logged to the new file
+	c = gotcha.New(newAOFOption(t, aofPath).SetSnapshotFile(snapshotPath, 0))
+	defer c.Close()
+	err = c.Set("key-2", "key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_ = os.Remove(snapshotPath)
+
+	restored := gotcha.New(newAOFOption(t, aofPath))
+	defer restored.Close()
+	keys, err := restored.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"key-1", "key-2"}) {
+		t.Fatalf("expected: %v, got %v", []string{"key-1", "key-2"}, keys)
+	}
+}
@@ -0,0 +1,48 @@
+package gotcha_test
+
+import (
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestArena(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetAlgorithm(cache.ArenaAlgorithm).SetMaxMemory(cache.KB))
+	err := c.SetWithTags("key-1", []byte("value-1"), "tag-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if string(val.([]byte)) != "value-1" {
+		t.Fatalf("expected: %v, got %v", "value-1", val)
+	}
+
+	// Only the []byte values are stored in the arena
+	err = c.Set("key-2", "value-2")
+	if err != cache.ErrUnsupportedValue {
+		t.Fatalf("expected: %v, got %v", cache.ErrUnsupportedValue, err)
+	}
+
+	// The oldest items are evicted when the arena is full
+	for i := 0; i < 10; i++ {
+		err = c.Set("key-3", make([]byte, 512))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	if c.Contains("key-1") {
+		t.Fatalf("expected: %v, got %v", "evicted", "key-1")
+	}
+	// The evicted item is removed from the tag
+	deleted, err := c.InvalidateTag("tag-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != 0 {
+		t.Fatalf("expected: %v, got %v", 0, deleted)
+	}
+}
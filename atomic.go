@@ -0,0 +1,61 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// GetWithVersion will retrieve the item from cache with its version,
+// the version is used as the token of CompareAndSwap
+func (c *Cache) GetWithVersion(key string) (value interface{}, version uint64, err error) {
+	// Write lock, since retrieving the item will update the recent-ness or the frequency
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.get(key)
+	if err != nil {
+		return
+	}
+	if c.isEarlyExpired(doc) {
+		return nil, 0, cache.ErrMissed
+	}
+	return doc.Value, doc.Version, nil
+}
+
+// Add will set the item to cache only if the key doesn't exist or already expired,
+// otherwise cache.ErrExists is returned
+func (c *Cache) Add(key string, value interface{}) (err error) {
+	document := c.newDocument(key, value)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err = c.peekMetadata(key); err == nil {
+		return cache.ErrExists
+	}
+	return c.store(document)
+}
+
+// Replace will set the item to cache only if the key already exists,
+// otherwise cache.ErrMissed is returned
+func (c *Cache) Replace(key string, value interface{}) (err error) {
+	document := c.newDocument(key, value)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err = c.peekMetadata(key); err != nil {
+		return
+	}
+	return c.store(document)
+}
+
+// CompareAndSwap will set the item to cache only if the item hasn't been changed since the given version.
+// It returns cache.ErrVersionMismatch if the item has been changed, or cache.ErrMissed if it doesn't exist
+func (c *Cache) CompareAndSwap(key string, version uint64, value interface{}) (err error) {
+	document := c.newDocument(key, value)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.peekMetadata(key)
+	if err != nil {
+		return
+	}
+	if doc.Version != version {
+		return cache.ErrVersionMismatch
+	}
+	return c.store(document)
+}
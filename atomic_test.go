@@ -0,0 +1,167 @@
+package gotcha_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestAdd(t *testing.T) {
+	c := gotcha.New()
+	err := c.Add("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Add("name", "Arya Stark")
+	if err != cache.ErrExists {
+		t.Fatalf("expected: %v, got %v", cache.ErrExists, err)
+	}
+	val, err := c.Get("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "John Snow" {
+		t.Fatalf("expected: %v, got %v", "John Snow", val)
+	}
+
+	// The expired item can be replaced
+	err = c.Touch("name", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Add("name", "Arya Stark")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err = c.Get("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "Arya Stark" {
+		t.Fatalf("expected: %v, got %v", "Arya Stark", val)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	c := gotcha.New()
+	err := c.Replace("name", "John Snow")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+	_, err = c.Get("name")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+
+	err = c.Set("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Replace("name", "Aegon Targaryen")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.Get("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "Aegon Targaryen" {
+		t.Fatalf("expected: %v, got %v", "Aegon Targaryen", val)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	c := gotcha.New()
+	err := c.CompareAndSwap("name", 1, "John Snow")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+
+	err = c.Set("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, version, err := c.GetWithVersion("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	err = c.CompareAndSwap("name", version, "Aegon Targaryen")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// The version is changed by the previous swap
+	err = c.CompareAndSwap("name", version, "Jon Targaryen")
+	if err != cache.ErrVersionMismatch {
+		t.Fatalf("expected: %v, got %v", cache.ErrVersionMismatch, err)
+	}
+
+	val, newVersion, err := c.GetWithVersion("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "Aegon Targaryen" {
+		t.Fatalf("expected: %v, got %v", "Aegon Targaryen", val)
+	}
+	if newVersion == version {
+		t.Fatalf("expected: %v, got %v", "new version", newVersion)
+	}
+}
+
+func TestConditionalWriteConcurrent(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm))
+			var wg sync.WaitGroup
+			var mutex sync.Mutex
+			added := 0
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if c.Add("lock", "owner") == nil {
+						mutex.Lock()
+						added++
+						mutex.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if added != 1 {
+				t.Fatalf("expected: %v, got %v", 1, added)
+			}
+
+			err := c.Set("counter", 0)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						val, version, err := c.GetWithVersion("counter")
+						if err != nil {
+							t.Errorf("expected: %v, got %v", nil, err)
+							return
+						}
+						if c.CompareAndSwap("counter", version, val.(int)+1) == nil {
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			val, err := c.Get("counter")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != 50 {
+				t.Fatalf("expected: %v, got %v", 50, val)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// GetMany will retrieve the items from cache with a single lock acquisition.
+// The missing and expired keys are returned in missing, in the same order as the given keys
+func (c *Cache) GetMany(keys []string) (values map[string]interface{}, missing []string) {
+	values = make(map[string]interface{}, len(keys))
+
+	// Write lock, since retrieving the items will update the recent-ness or the frequency
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range keys {
+		doc, err := c.get(key)
+		if err != nil || c.isEarlyExpired(doc) {
+			missing = append(missing, key)
+			continue
+		}
+		values[key] = doc.Value
+	}
+	return
+}
+
+// SetMany will set the items to cache with a single lock acquisition.
+// If some items failed to be stored, the rest are still stored and a *cache.BatchError is returned
+func (c *Cache) SetMany(items map[string]interface{}) (err error) {
+	failed := map[string]error{}
+	c.mutex.Lock()
+	for key, value := range items {
+		if errSet := c.store(c.newDocument(key, value)); errSet != nil {
+			failed[key] = errSet
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(failed) > 0 {
+		return &cache.BatchError{Errors: failed}
+	}
+	return nil
+}
+
+// DeleteMany will remove the items from cache with a single lock acquisition.
+// The keys that don't exist are ignored. If some items failed to be removed,
+// the rest are still removed and a *cache.BatchError is returned
+func (c *Cache) DeleteMany(keys []string) (err error) {
+	failed := map[string]error{}
+	c.mutex.Lock()
+	for _, key := range keys {
+		if _, errDelete := c.remove(key); errDelete != nil {
+			failed[key] = errDelete
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(failed) > 0 {
+		return &cache.BatchError{Errors: failed}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package gotcha_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestBatch(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm))
+			err := c.SetMany(map[string]interface{}{
+				"name":    "John Snow",
+				"kingdom": "North Kingdom",
+				"house":   "Stark",
+			})
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			values, missing := c.GetMany([]string{"name", "sword", "kingdom", "house", "dragon"})
+			if len(values) != 3 {
+				t.Fatalf("expected: %v, got %v", 3, len(values))
+			}
+			if values["name"] != "John Snow" {
+				t.Fatalf("expected: %v, got %v", "John Snow", values["name"])
+			}
+			if fmt.Sprint(missing) != "[sword dragon]" {
+				t.Fatalf("expected: %v, got %v", "[sword dragon]", missing)
+			}
+
+			err = c.DeleteMany([]string{"name", "house", "sword"})
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			values, missing = c.GetMany([]string{"name", "kingdom", "house"})
+			if len(values) != 1 || values["kingdom"] != "North Kingdom" {
+				t.Fatalf("expected: %v, got %v", "only kingdom", values)
+			}
+			if fmt.Sprint(missing) != "[name house]" {
+				t.Fatalf("expected: %v, got %v", "[name house]", missing)
+			}
+		})
+	}
+}
+
+func TestSetManyPartialFailure(t *testing.T) {
+	// The max memory will encode the items, and a func can't be encoded
+	c := gotcha.New(gotcha.NewOption().SetMaxMemory(cache.MB))
+	err := c.SetMany(map[string]interface{}{
+		"name":    "John Snow",
+		"invalid": func() {},
+	})
+	batchErr, ok := err.(*cache.BatchError)
+	if !ok {
+		t.Fatalf("expected: %v, got %v", "*cache.BatchError", err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors["invalid"] == nil {
+		t.Fatalf("expected: %v, got %v", "invalid key failed", batchErr.Errors)
+	}
+
+	val, err := c.Get("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "John Snow" {
+		t.Fatalf("expected: %v, got %v", "John Snow", val)
+	}
+	_, err = c.Get("invalid")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestBatchConcurrent(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(1000))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			items := map[string]interface{}{}
+			keys := []string{}
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("key-%d-%d", i, j)
+				items[key] = j
+				keys = append(keys, key)
+			}
+			if err := c.SetMany(items); err != nil {
+				t.Errorf("expected: %v, got %v", nil, err)
+			}
+			if _, missing := c.GetMany(keys); len(missing) != 0 {
+				t.Errorf("expected: %v, got %v", 0, len(missing))
+			}
+			if err := c.DeleteMany(keys); err != nil {
+				t.Errorf("expected: %v, got %v", nil, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	keys, err := c.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected: %v, got %v", 0, len(keys))
+	}
+}
@@ -1,13 +1,40 @@
 package cache
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand"
+	"sort"
+	"strings"
 	"time"
 )
 
 var (
 	// ErrMissed ...
 	ErrMissed = errors.New("Cache item's missing")
+	// ErrExists is returned when adding an item that already exists
+	ErrExists = errors.New("Cache item's already exists")
+	// ErrVersionMismatch is returned when the item has been changed since the given version
+	ErrVersionMismatch = errors.New("Cache item's version mismatch")
+	// ErrNotSupported is returned when the operation is not supported by the algorithm
+	ErrNotSupported = errors.New("Cache operation's not supported by the algorithm")
+	// ErrOverflow is returned when incrementing an item overflows its value
+	ErrOverflow = errors.New("Cache item's value overflow")
+	// ErrSnapshotVersion is returned when loading the snapshot saved with an unsupported format
+	ErrSnapshotVersion = errors.New("Cache snapshot's version not supported")
+	// ErrSnapshotCorrupted is returned when loading the snapshot file that fails the checksum
+	ErrSnapshotCorrupted = errors.New("Cache snapshot's corrupted")
+	// ErrUnsupportedValue is returned when the codec can't encode or decode the value
+	ErrUnsupportedValue = errors.New("Cache item's value not supported by the codec")
+	// ErrEncryptionKey is returned when the value is encrypted with a key that's not in the encryption keys
+	ErrEncryptionKey = errors.New("Cache encryption key's missing")
+	// ErrEncryptionKeyID is returned when the ID of the encryption key is longer than 255 bytes
+	ErrEncryptionKeyID = errors.New("Cache encryption key's ID too long")
+	// ErrTooLarge is returned when the item is bigger than the capacity of the arena
+	ErrTooLarge = errors.New("Cache item's too large")
 )
 
 const (
@@ -21,6 +48,9 @@ const (
 	LRUAlgorithm = "lru"
 	// LFUAlgorithm ...
 	LFUAlgorithm = "lfu"
+	// ArenaAlgorithm stores the []byte values in a preallocated ring buffer sized by the max memory,
+	// to cut the GC scan time of the big caches
+	ArenaAlgorithm = "arena"
 	// DefaultSize ..
 	DefaultSize = 100
 	// DefaultExpiryTime ...
@@ -29,21 +59,254 @@ const (
 	DefaultAlgorithm = LRUAlgorithm
 	// DefaultMaxMemory ...
 	DefaultMaxMemory = 10 * MB
+	// DefaultBatchWait is the default time window the dispatcher collects the keys before loading them
+	DefaultBatchWait = time.Millisecond * 5
+	// DefaultMaxBatch is the default maximum keys loaded at once by the dispatcher
+	DefaultMaxBatch = 100
+	// DefaultAOFRewriteSize is the default minimum size of the append only file before it's rewritten
+	DefaultAOFRewriteSize = 64 * MB
+	// DefaultCompressionThreshold is the default size of the encoded values to be compressed
+	DefaultCompressionThreshold = 1 * KB
+	// DefaultDiskTierSegmentSize is the default size of the segment files of the disk tier
+	DefaultDiskTierSegmentSize = 64 * MB
+	// NoExpiration is the TTL of the item that will never be expired
+	NoExpiration time.Duration = -1
+	// NamespaceSeparator separates the namespace name and the key of the items stored in the namespace
+	NamespaceSeparator = ":"
 )
 
+// BatchError represent the keys that failed in a batch operation,
+// the other keys in the batch are applied
+type BatchError struct {
+	Errors map[string]error // failed keys with their error
+}
+
+// Error implements the error interface
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for k := range e.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, len(keys))
+	for i, k := range keys {
+		msgs[i] = fmt.Sprintf("%s: %v", k, e.Errors[k])
+	}
+	return fmt.Sprintf("%d keys failed: %s", len(keys), strings.Join(msgs, "; "))
+}
+
+// NotNumericError is returned when incrementing or decrementing an item with a non numeric value
+type NotNumericError struct {
+	Key   string
+	Value interface{}
+}
+
+// Error implements the error interface
+func (e *NotNumericError) Error() string {
+	return fmt.Sprintf("Cache item's %q value is not numeric: %T", e.Key, e.Value)
+}
+
 // Document represent the Document structure stored in the cache
 type Document struct {
 	Key        string
 	Value      interface{}
-	StoredTime int64 // timestamp
+	StoredTime int64         // timestamp
+	TTL        time.Duration // time to live since the stored time, set by the repository when it's zero
+	Delta      time.Duration `json:",omitempty"` // time spent to recompute the value, used for early expiration
+	Version    uint64        `json:",omitempty"` // changed on every write, used as the CAS token
+	Tags       []string      `json:",omitempty"` // used to invalidate a group of items at once
+	KeyID      string        `json:",omitempty"` // ID of the encryption key of the stored value
+}
+
+// ExpiresAt returns the time when the document will be expired,
+// or zero time if the document will never be expired
+func (d *Document) ExpiresAt() time.Time {
+	if d.TTL == NoExpiration {
+		return time.Time{}
+	}
+	return time.Unix(d.StoredTime, 0).Add(d.TTL)
+}
+
+// IsExpired checks if the document is already expired
+func (d *Document) IsExpired() bool {
+	if d.TTL == NoExpiration {
+		return false
+	}
+	return time.Now().After(d.ExpiresAt())
+}
+
+// ExpiryStats represent the distribution of the expiry time of the stored items
+type ExpiryStats struct {
+	Count     int           // total of the stored items that will be expired
+	NoExpiry  int           // total of the stored items that will never be expired
+	Min       time.Duration // the shortest remaining time to live
+	Max       time.Duration // the longest remaining time to live
+	Mean      time.Duration // the average remaining time to live
+	Histogram []ExpiryBucket
+}
+
+// ExpiryBucket represent the total of items that will be expired within [Start, End)
+type ExpiryBucket struct {
+	Start time.Duration
+	End   time.Duration
+	Count int
+}
+
+// NamespaceStats represent the stats of the items stored in a namespace
+type NamespaceStats struct {
+	Items     int    // total of the non expired items
+	Hits      uint64 // total of Get calls that found the item
+	Misses    uint64 // total of Get calls that missed the item
+	Evictions uint64 // total of items evicted because the quota of the namespace reached
+}
+
+// Namespace represent a view over the cache that prefixes its keys with the namespace name,
+// so the namespaces share the capacity of the cache without colliding keys
+type Namespace interface {
+	Name() string
+	Set(key string, value interface{}) (err error)
+	Get(key string) (val interface{}, err error)
+	Peek(key string) (val interface{}, err error)
+	Contains(key string) (ok bool)
+	Delete(key string) (err error)
+	GetKeys() (keys []string, err error)
+	ClearCache() (err error)
+	Stats() (stats NamespaceStats, err error)
+	SetQuota(maxSizeItem uint64)
+}
+
+// AOFSyncPolicy defines how often the append only file is synced to the disk
+type AOFSyncPolicy int
+
+const (
+	// AOFSyncEverySecond syncs the append only file every second, a crash loses at most a second of writes
+	AOFSyncEverySecond AOFSyncPolicy = iota
+	// AOFSyncAlways syncs the append only file on every write, it's the most durable and the slowest
+	AOFSyncAlways
+	// AOFSyncNever leaves syncing the append only file to the operating system
+	AOFSyncNever
+)
+
+// Codec turns the values into bytes and back, e.g to measure the memory of the items
+type Codec interface {
+	ContentType() string // identifies the encoding, e.g application/json
+	Marshal(v interface{}) (data []byte, err error)
+	Unmarshal(data []byte, v interface{}) (err error)
+}
+
+// Encoder writes the encoded values to the underlying stream
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads the values from the underlying stream
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Compressor compresses the encoded values, e.g gotcha.GzipCompressor
+type Compressor interface {
+	Compress(data []byte) (compressed []byte, err error)
+	Decompress(compressed []byte) (data []byte, err error)
+}
+
+// EncryptionKey is the AES key of 16, 24 or 32 bytes, identified by the ID stored with the encrypted values
+type EncryptionKey struct {
+	ID  string // up to 255 bytes
+	Key []byte
+}
+
+// SnapshotCodec is used to encode and decode the snapshot of the cache,
+// e.g gob.NewEncoder and gob.NewDecoder
+type SnapshotCodec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// LoaderFunc is used to load the value of a missing key, e.g from the database
+type LoaderFunc func(ctx context.Context, key string) (value interface{}, err error)
+
+// IterationMode defines how the iterators of the cache deal with the concurrent mutation
+type IterationMode int
+
+const (
+	// SnapshotIteration copies the items under the read lock, and iterates the copy without holding the lock.
+	// The loop body may use the cache, but the copy costs an allocation of every item
+	SnapshotIteration IterationMode = iota
+	// LiveIteration iterates the items while holding the read lock without copying them.
+	// The concurrent writes wait until the iteration is done, so the loop body must not call any method
+	// of the cache, not even Get, which takes the write lock to update the recent-ness or the frequency
+	LiveIteration
+)
+
+// IsolationMode defines when the values are copied, so the caller mutating a value doesn't affect
+// the value in the cache. The modes can be combined, e.g CopyOnWrite | CopyOnRead
+type IsolationMode int
+
+const (
+	// NoIsolation stores and returns the values as is, the fastest but a mutated map or pointer leaks to
+	// the other callers
+	NoIsolation IsolationMode = 0
+	// CopyOnWrite copies the value on Set, so the caller may keep mutating the value it stored.
+	// It costs a copy on every write
+	CopyOnWrite IsolationMode = 1 << 0
+	// CopyOnRead copies the value on Get and the other reads, so the caller may mutate the returned value.
+	// It costs a copy on every read, which is usually more frequent than the write
+	CopyOnRead IsolationMode = 1 << 1
+)
+
+// Cloner returns a deep copy of the value, e.g gotcha.CodecCloner
+type Cloner interface {
+	Clone(value interface{}) (cloned interface{}, err error)
 }
 
+// KeyFilter selects the keys with the prefix and matching the glob pattern, the empty filter selects all keys.
+// The pattern syntax is the same as path.Match
+type KeyFilter struct {
+	Prefix  string
+	Pattern string
+}
+
+// BatchLoaderFunc is used to load the values of the missing keys at once, e.g with a single query.
+// The keys that are not returned in values are considered missing
+type BatchLoaderFunc func(ctx context.Context, keys []string) (values map[string]interface{}, err error)
+
+// UpdateFunc receives the current value of the item and whether it exists,
+// and returns the new value. Returning keep false will remove the item
+type UpdateFunc func(old interface{}, exists bool) (newValue interface{}, keep bool)
+
 // Option used for Cache configuration
 type Option struct {
-	AlgorithmType string        // represent the algorithm type
-	ExpiryTime    time.Duration // represent the expiry time of each stored item
-	MaxSizeItem   uint64        // Max size of item for eviction
-	MaxMemory     uint64        // Max Memory of item stored for eviction
+	AlgorithmType        string          // represent the algorithm type
+	ExpiryTime           time.Duration   // represent the expiry time of each stored item
+	MaxSizeItem          uint64          // Max size of item for eviction
+	MaxMemory            uint64          // Max Memory of item stored for eviction
+	ExpiryJitter         float64         // percentage of the expiry time used to randomize the expiry, e.g 0.1 for ±10%
+	JitterRange          time.Duration   // absolute range used to randomize the expiry, take precedence over ExpiryJitter
+	ResetFrequency       bool            // reset the frequency of the updated item in LFU, by default the frequency is kept
+	KeyIndex             bool            // maintain a radix tree of the keys, so the prefix operations don't scan all keys
+	IterationMode        IterationMode   // how the iterators deal with the concurrent mutation, default is SnapshotIteration
+	XFetchBeta           float64         // XFetch beta for probabilistic early expiration, zero means disabled
+	RandSource           rand.Source     // random source used by XFetch, default is seeded by the current time
+	SnapshotCodec        SnapshotCodec   // codec used by Save and Load, default is gob
+	SnapshotPath         string          // file loaded by New, and saved on Close and every SnapshotInterval
+	SnapshotInterval     time.Duration   // interval of the background snapshot, zero means only on Close
+	OnSnapshotError      func(err error) // called with the error of loading or saving the snapshot in background
+	AOFPath              string          // append only file logging the writes, replayed by New instead of the snapshot
+	AOFSync              AOFSyncPolicy   // how often the append only file is synced, default is every second
+	AOFRewriteSize       uint64          // the append only file is rewritten when it doubles since the last rewrite and reaches this size
+	OnAOFError           func(err error) // called with the error of the append only file that can't be returned
+	DiskTierPath         string          // directory of the disk tier storing the evicted items, empty means disabled
+	DiskTierSegmentSize  uint64          // size of the segment files of the disk tier
+	DiskTierMaxSize      uint64          // max size of the segment files of the disk tier, zero means unlimited
+	OnDiskTierError      func(err error) // called with the error of spilling the evicted item to the disk tier
+	Codec                Codec           // codec of the values measured by the max memory and persisted, default measures all items as JSON
+	Compressor           Compressor      // compress the values encoded by the codec, nil means disabled
+	CompressionThreshold *uint64         // the encoded values smaller than the threshold are not compressed, nil means 1KB
+	EncryptionKeys       []EncryptionKey // the first key encrypts the values and the snapshots, the others only decrypt
+	Isolation            IsolationMode   // when the values are copied, default is NoIsolation
+	Cloner               Cloner          // copies the values, default is the deep copy with the codec
 }
 
 // SetAlgorithm will set the algorithm value
@@ -70,11 +333,199 @@ func (o *Option) SetMaxMemory(memory uint64) *Option {
 	return o
 }
 
+// SetExpiryJitter will randomize the expiry time of each stored item by the given percentage,
+// e.g 0.1 will spread the expiry time within ±10% of the expiry time
+func (o *Option) SetExpiryJitter(percentage float64) *Option {
+	o.ExpiryJitter = percentage
+	return o
+}
+
+// SetJitterRange will randomize the expiry time of each stored item within ±jitter
+func (o *Option) SetJitterRange(jitter time.Duration) *Option {
+	o.JitterRange = jitter
+	return o
+}
+
+// SetResetFrequency defines whether updating an existing item in LFU will reset its frequency
+func (o *Option) SetResetFrequency(reset bool) *Option {
+	o.ResetFrequency = reset
+	return o
+}
+
+// SetKeyIndex will maintain a radix tree of the keys, so the prefix and pattern operations
+// don't scan all the keys, at the cost of the memory and the write performance
+func (o *Option) SetKeyIndex(enabled bool) *Option {
+	o.KeyIndex = enabled
+	return o
+}
+
+// SetIterationMode will set how the iterators deal with the concurrent mutation
+func (o *Option) SetIterationMode(mode IterationMode) *Option {
+	o.IterationMode = mode
+	return o
+}
+
+// SetXFetchBeta will enable the probabilistic early expiration (XFetch).
+// A beta of 1.0 is the recommended value, a bigger value favors earlier recomputation
+func (o *Option) SetXFetchBeta(beta float64) *Option {
+	o.XFetchBeta = beta
+	return o
+}
+
+// SetRandSource will set the random source used by the early expiration
+func (o *Option) SetRandSource(src rand.Source) *Option {
+	o.RandSource = src
+	return o
+}
+
+// SetSnapshotCodec will set the codec used to save and load the snapshot of the cache
+func (o *Option) SetSnapshotCodec(codec SnapshotCodec) *Option {
+	o.SnapshotCodec = codec
+	return o
+}
+
+// SetSnapshotFile will load the snapshot from the path when the cache is created,
+// and save the snapshot to the path on Close and every interval. Zero interval means only on Close
+func (o *Option) SetSnapshotFile(path string, interval time.Duration) *Option {
+	o.SnapshotPath = path
+	o.SnapshotInterval = interval
+	return o
+}
+
+// SetOnSnapshotError will set the handler of the error of loading or saving the snapshot in background
+func (o *Option) SetOnSnapshotError(fn func(err error)) *Option {
+	o.OnSnapshotError = fn
+	return o
+}
+
+// SetAppendOnlyFile will log every write to the file with the given sync policy, and replay the file
+// when the cache is created. The snapshot file isn't loaded if the append only file exists
+func (o *Option) SetAppendOnlyFile(path string, policy AOFSyncPolicy) *Option {
+	o.AOFPath = path
+	o.AOFSync = policy
+	return o
+}
+
+// SetAOFRewriteSize will set the minimum size of the append only file before it's rewritten
+func (o *Option) SetAOFRewriteSize(size uint64) *Option {
+	o.AOFRewriteSize = size
+	return o
+}
+
+// SetOnAOFError will set the handler of the error of the append only file that can't be returned,
+// e.g syncing in background, logging the evicted items, or replaying the corrupted file
+func (o *Option) SetOnAOFError(fn func(err error)) *Option {
+	o.OnAOFError = fn
+	return o
+}
+
+// SetDiskTier will spill the evicted items to the segment files in the directory, and Get will promote
+// the items found in the disk tier back to the memory. The segment files are removed when the cache is created and closed
+func (o *Option) SetDiskTier(dir string) *Option {
+	o.DiskTierPath = dir
+	return o
+}
+
+// SetDiskTierSegmentSize will set the size of the segment files of the disk tier
+func (o *Option) SetDiskTierSegmentSize(size uint64) *Option {
+	o.DiskTierSegmentSize = size
+	return o
+}
+
+// SetDiskTierMaxSize will drop the oldest segment files of the disk tier once their size reaches the max size
+func (o *Option) SetDiskTierMaxSize(size uint64) *Option {
+	o.DiskTierMaxSize = size
+	return o
+}
+
+// SetOnDiskTierError will set the handler of the error of spilling the evicted item to the disk tier
+func (o *Option) SetOnDiskTierError(fn func(err error)) *Option {
+	o.OnDiskTierError = fn
+	return o
+}
+
+// SetCodec will set the codec of the values. The max memory is measured by the size of each encoded value
+// and key, instead of encoding all the items to JSON on every write. The values of the snapshots,
+// the append only file and the disk tier are encoded by the codec, within the records of the snapshot codec
+func (o *Option) SetCodec(codec Codec) *Option {
+	o.Codec = codec
+	return o
+}
+
+// SetCompression will compress the values encoded by the codec, GobCodec by default, if they reach the threshold.
+// Zero threshold compresses all the values, use DefaultCompressionThreshold for the default.
+// The values are decompressed and decoded on read, and the max memory is measured by the stored size
+func (o *Option) SetCompression(compressor Compressor, threshold uint64) *Option {
+	o.Compressor = compressor
+	o.CompressionThreshold = &threshold
+	return o
+}
+
+// SetEncryptionKeys will encrypt the values encoded by the codec, GobCodec by default, and the snapshots,
+// the append only file and the disk tier with AES-GCM using the primary key.
+// The previous keys only decrypt the data encrypted before the primary key is rotated.
+// The keys must be 16, 24 or 32 bytes with the ID up to 255 bytes, otherwise New panics
+func (o *Option) SetEncryptionKeys(primary EncryptionKey, previous ...EncryptionKey) *Option {
+	o.EncryptionKeys = append([]EncryptionKey{primary}, previous...)
+	return o
+}
+
+// SetIsolation will copy the values on write and/or read with the cloner, or with the codec, GobCodec by default,
+// if the cloner is nil. The strings, the numbers and the booleans are never copied since they're immutable.
+// The values encoded by the compression or the encryption are always isolated, so the mode is ignored
+func (o *Option) SetIsolation(mode IsolationMode, cloner Cloner) *Option {
+	o.Isolation = mode
+	o.Cloner = cloner
+	return o
+}
+
 // Cache represent the public API that will available used by user
 type Cache interface {
 	Set(key string, value interface{}) error
+	SetWithTags(key string, value interface{}, tags ...string) error
+	InvalidateTag(tag string) (deleted int, err error)
 	Get(key string) (val interface{}, err error)
+	GetWithVersion(key string) (val interface{}, version uint64, err error)
+	Add(key string, value interface{}) (err error)
+	Replace(key string, value interface{}) (err error)
+	CompareAndSwap(key string, version uint64, value interface{}) (err error)
+	Increment(key string, delta int64) (val int64, err error)
+	Decrement(key string, delta int64) (val int64, err error)
+	IncrementFloat(key string, delta float64) (val float64, err error)
+	DecrementFloat(key string, delta float64) (val float64, err error)
+	Update(key string, fn UpdateFunc) (err error)
+	ComputeIfAbsent(key string, fn func(key string) (interface{}, error)) (val interface{}, err error)
+	ComputeIfPresent(key string, fn func(key string, old interface{}) (newValue interface{}, keep bool)) (val interface{}, err error)
+	GetMany(keys []string) (values map[string]interface{}, missing []string)
+	SetMany(items map[string]interface{}) (err error)
+	DeleteMany(keys []string) (err error)
+	Peek(key string) (val interface{}, err error)
+	Contains(key string) (ok bool)
+	GetAndDelete(key string) (val interface{}, err error)
+	PopOldest() (key string, val interface{}, err error)
+	PopLeastFrequent() (key string, val interface{}, err error)
+	GetOrLoad(ctx context.Context, key string, loader LoaderFunc) (val interface{}, err error)
+	GetManyOrLoad(ctx context.Context, keys []string, loader BatchLoaderFunc) (values map[string]interface{}, err error)
 	Delete(key string) (err error)
 	GetKeys() (keys []string, err error)
+	KeysMatching(pattern string) (keys []string, err error)
+	DeleteByPrefix(prefix string) (deleted int, err error)
+	DeleteMatching(pattern string) (deleted int, err error)
+	All() iter.Seq2[string, interface{}]
+	Keys() iter.Seq[string]
 	ClearCache() (err error)
+	ExpiryStats() (stats ExpiryStats, err error)
+	TTL(key string) (ttl time.Duration, err error)
+	Touch(key string, ttl time.Duration) (err error)
+	ExpireAt(key string, expiry time.Time) (err error)
+	Persist(key string) (err error)
+	Namespace(name string) Namespace
+	Save(w io.Writer) (err error)
+	Load(r io.Reader) (err error)
+	SaveFile(path string) (err error)
+	LoadFile(path string) (err error)
+	RewriteAOF() (err error)
+	Export(w io.Writer, filter KeyFilter) (exported int, err error)
+	Import(r io.Reader, filter KeyFilter) (imported int, err error)
+	Close() (err error)
 }
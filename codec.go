@@ -0,0 +1,179 @@
+package gotcha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// JSONCodec encodes the values with encoding/json. Without RegisterType, the values are decoded
+// as the JSON types, e.g the structs are decoded as map[string]interface{}
+type JSONCodec struct{}
+
+// ContentType return the content type of JSON
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
+
+// Marshal encodes the value to JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the JSON to the value
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec encodes the values with encoding/gob as an interface, so the concrete type is kept.
+// The types other than the basic types must be registered with RegisterType or gob.Register
+type GobCodec struct{}
+
+// ContentType return the content type of gob
+func (GobCodec) ContentType() string {
+	return "application/x-gob"
+}
+
+// Marshal encodes the value to gob
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the gob to the value, v must be a pointer to the type of the encoded value or interface{}
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	var decoded interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		return err
+	}
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return cache.ErrUnsupportedValue
+	}
+	if decoded == nil {
+		ptr.Elem().Set(reflect.Zero(ptr.Elem().Type()))
+		return nil
+	}
+	value := reflect.ValueOf(decoded)
+	if !value.Type().AssignableTo(ptr.Elem().Type()) {
+		return cache.ErrUnsupportedValue
+	}
+	ptr.Elem().Set(value)
+	return nil
+}
+
+// RawCodec stores the []byte values as is, the other values are not supported
+type RawCodec struct{}
+
+// ContentType return the content type of the raw bytes
+func (RawCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+// Marshal returns the []byte value as is
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, cache.ErrUnsupportedValue
+	}
+	return data, nil
+}
+
+// Unmarshal copies the data to the value, v must be a *[]byte or *interface{}
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	copied := append([]byte(nil), data...)
+	switch ptr := v.(type) {
+	case *[]byte:
+		*ptr = copied
+	case *interface{}:
+		*ptr = copied
+	default:
+		return cache.ErrUnsupportedValue
+	}
+	return nil
+}
+
+// typeRegistry maps the registered types with their names
+var typeRegistry = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: map[string]reflect.Type{},
+	byType: map[reflect.Type]string{},
+}
+
+// RegisterType will register the type of the value with the name, so MarshalValue and UnmarshalValue
+// round-trip the value with its type. The type is also registered to gob with gob.Register.
+// The name must be the same across the processes sharing the encoded values
+func RegisterType(name string, value interface{}) {
+	t := reflect.TypeOf(value)
+	typeRegistry.Lock()
+	typeRegistry.byName[name] = t
+	typeRegistry.byType[t] = name
+	typeRegistry.Unlock()
+	gob.Register(value)
+}
+
+// MarshalValue encodes the value with the codec, prefixed by the name of its type if it's registered
+// with RegisterType, so UnmarshalValue decodes the value to the same type
+func MarshalValue(codec cache.Codec, value interface{}) (data []byte, err error) {
+	typeRegistry.RLock()
+	name := typeRegistry.byType[reflect.TypeOf(value)]
+	typeRegistry.RUnlock()
+
+	encoded, err := codec.Marshal(value)
+	if err != nil {
+		return
+	}
+	data = binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(name)+len(encoded)), uint64(len(name)))
+	data = append(data, name...)
+	data = append(data, encoded...)
+	return
+}
+
+// UnmarshalValue decodes the value encoded by MarshalValue. The value of the registered type is decoded
+// to the type, the other values are decoded to interface{} by the codec
+func UnmarshalValue(codec cache.Codec, data []byte) (value interface{}, err error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, cache.ErrUnsupportedValue
+	}
+	name := string(data[n : n+int(length)])
+	encoded := data[n+int(length):]
+	if name == "" {
+		err = codec.Unmarshal(encoded, &value)
+		return
+	}
+
+	typeRegistry.RLock()
+	t, ok := typeRegistry.byName[name]
+	typeRegistry.RUnlock()
+	if !ok {
+		return nil, cache.ErrUnsupportedValue
+	}
+	ptr := reflect.New(t)
+	if err = codec.Unmarshal(encoded, ptr.Interface()); err != nil {
+		return
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// codecSizer measures the document by the size of its key and encoded value
+func codecSizer(codec cache.Codec) func(doc *cache.Document) (uint64, error) {
+	return func(doc *cache.Document) (uint64, error) {
+		data, err := codec.Marshal(doc.Value)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(len(doc.Key) + len(data)), nil
+	}
+}
@@ -0,0 +1,189 @@
+package gotcha_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+type codecUser struct {
+	Name string
+	Age  int
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	gotcha.RegisterType("codec-user", codecUser{})
+	for _, codec := range []cache.Codec{gotcha.JSONCodec{}, gotcha.GobCodec{}} {
+		t.Run(codec.ContentType(), func(t *testing.T) {
+			user := codecUser{Name: "john", Age: 30}
+			data, err := gotcha.MarshalValue(codec, user)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			val, err := gotcha.UnmarshalValue(codec, data)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if !reflect.DeepEqual(val, user) {
+				t.Fatalf("expected: %#v, got %#v", user, val)
+			}
+
+			// The unregistered type is decoded by the codec as is
+			data, err = gotcha.MarshalValue(codec, "hello")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			val, err = gotcha.UnmarshalValue(codec, data)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "hello" {
+				t.Fatalf("expected: %v, got %v", "hello", val)
+			}
+		})
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	codec := gotcha.RawCodec{}
+	data, err := gotcha.MarshalValue(codec, []byte("hello"))
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := gotcha.UnmarshalValue(codec, data)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(val, []byte("hello")) {
+		t.Fatalf("expected: %v, got %v", []byte("hello"), val)
+	}
+
+	_, err = codec.Marshal("hello")
+	if err != cache.ErrUnsupportedValue {
+		t.Fatalf("expected: %v, got %v", cache.ErrUnsupportedValue, err)
+	}
+}
+
+func TestCodecMaxMemory(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			// Each item is 5 bytes of key and 100 bytes of value
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetCodec(gotcha.RawCodec{}).SetMaxMemory(250))
+			for _, key := range []string{"key-1", "key-2", "key-3"} {
+				err := c.Set(key, make([]byte, 100))
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			keys, err := c.GetKeys()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(keys) != 2 || c.Contains("key-1") {
+				t.Fatalf("expected: %v, got %v", "[key-2 key-3]", keys)
+			}
+
+			// The value not supported by the codec is not stored
+			err = c.Set("key-4", "not bytes")
+			if err != cache.ErrUnsupportedValue {
+				t.Fatalf("expected: %v, got %v", cache.ErrUnsupportedValue, err)
+			}
+			if c.Contains("key-4") {
+				t.Fatalf("expected: %v, got %v", "not stored", "key-4")
+			}
+
+			// The item bigger than the max memory evicts all the items, including itself
+			err = c.Set("key-5", make([]byte, 300))
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			keys, err = c.GetKeys()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(keys) != 0 {
+				t.Fatalf("expected: %v, got %v", 0, keys)
+			}
+		})
+	}
+}
+
+func TestCodecPersistence(t *testing.T) {
+	gotcha.RegisterType("persisted-user", codecUser{})
+	user := codecUser{Name: "john", Age: 30}
+	newOption := func() *cache.Option {
+		return gotcha.NewOption().SetCodec(gotcha.JSONCodec{}).SetSnapshotCodec(gotcha.JSONSnapshotCodec{})
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		c := gotcha.New(newOption())
+		err := c.Set("key-1", user)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		var buf bytes.Buffer
+		err = c.Save(&buf)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+
+		// The value is restored with its type, instead of the JSON types of the snapshot codec
+		restored := gotcha.New(newOption())
+		err = restored.Load(&buf)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		val, err := restored.Get("key-1")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != user {
+			t.Fatalf("expected: %v, got %v", user, val)
+		}
+	})
+
+	t.Run("append-only-file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.aof")
+		c := gotcha.New(newOption().SetAppendOnlyFile(path, cache.AOFSyncAlways))
+		err := c.Set("key-1", user)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.Close()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+
+		restored := gotcha.New(newOption().SetAppendOnlyFile(path, cache.AOFSyncAlways))
+		defer restored.Close()
+		val, err := restored.Get("key-1")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != user {
+			t.Fatalf("expected: %v, got %v", user, val)
+		}
+	})
+
+	t.Run("disk-tier", func(t *testing.T) {
+		c := gotcha.New(newOption().SetMaxSizeItem(1).SetDiskTier(t.TempDir()))
+		defer c.Close()
+		for _, key := range []string{"key-1", "key-2"} {
+			err := c.Set(key, user)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		val, err := c.Get("key-1")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != user {
+			t.Fatalf("expected: %v, got %v", user, val)
+		}
+	})
+}
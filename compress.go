@@ -0,0 +1,118 @@
+package gotcha
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// GzipCompressor compresses the values with compress/gzip at the Level, gzip.DefaultCompression if zero
+type GzipCompressor struct {
+	Level int
+}
+
+// Compress compresses the data to gzip
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses the gzip data
+func (GzipCompressor) Decompress(compressed []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// FlateCompressor compresses the values with compress/flate at the Level, flate.DefaultCompression if zero.
+// It's smaller and faster than gzip, since it has no header and checksum
+type FlateCompressor struct {
+	Level int
+}
+
+// Compress compresses the data to DEFLATE
+func (f FlateCompressor) Compress(data []byte) ([]byte, error) {
+	level := f.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses the DEFLATE data
+func (FlateCompressor) Decompress(compressed []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(compressed))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// The flag prefixing the stored value, telling whether it's compressed
+const (
+	uncompressed byte = iota
+	compressed
+)
+
+// compression compresses the encoded values reaching the threshold
+type compression struct {
+	compressor cache.Compressor
+	threshold  uint64
+}
+
+func (t compression) apply(doc *cache.Document, data []byte) ([]byte, error) {
+	if uint64(len(data)) < t.threshold {
+		return append([]byte{uncompressed}, data...), nil
+	}
+	packed, err := t.compressor.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(packed) >= len(data) {
+		// Not compressible
+		return append([]byte{uncompressed}, data...), nil
+	}
+	return append([]byte{compressed}, packed...), nil
+}
+
+func (t compression) revert(doc *cache.Document, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, cache.ErrUnsupportedValue
+	}
+	switch data[0] {
+	case uncompressed:
+		return data[1:], nil
+	case compressed:
+		return t.compressor.Decompress(data[1:])
+	}
+	return nil, cache.ErrUnsupportedValue
+}
@@ -0,0 +1,174 @@
+package gotcha_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestCompressor(t *testing.T) {
+	data := bytes.Repeat([]byte("<div>hello</div>"), 100)
+	for name, compressor := range map[string]cache.Compressor{
+		"gzip":  gotcha.GzipCompressor{},
+		"flate": gotcha.FlateCompressor{Level: 9},
+	} {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := compressor.Compress(data)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(compressed) >= len(data) {
+				t.Fatalf("expected: %v, got %v", "compressed", len(compressed))
+			}
+			decompressed, err := compressor.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if !bytes.Equal(decompressed, data) {
+				t.Fatalf("expected: %v, got %v", len(data), len(decompressed))
+			}
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm, cache.ArenaAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			// The value doesn't fit in the max memory, unless it's compressed
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxMemory(4*cache.KB).
+				SetCompression(gotcha.GzipCompressor{}, 0))
+			large := strings.Repeat("<div>hello</div>", 1000)
+			err := c.Set("key-1", large)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			err = c.Set("key-2", "small")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			for key, expected := range map[string]string{"key-1": large, "key-2": "small"} {
+				val, err := c.Get(key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if val != expected {
+					t.Fatalf("expected: %v, got %v", len(expected), val)
+				}
+			}
+
+			// The decoded value is returned by the other reads
+			for key, val := range c.All() {
+				if key == "key-1" && val != large {
+					t.Fatalf("expected: %v, got %v", len(large), val)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressionCodec(t *testing.T) {
+	gotcha.RegisterType("compressed-user", codecUser{})
+	c := gotcha.New(gotcha.NewOption().SetCodec(gotcha.JSONCodec{}).SetCompression(gotcha.FlateCompressor{}, 1))
+	user := codecUser{Name: strings.Repeat("john", 100), Age: 30}
+	err := c.Set("key-1", user)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != user {
+		t.Fatalf("expected: %v, got %v", user, val)
+	}
+}
+
+type countingCompressor struct {
+	gotcha.GzipCompressor
+	compressed   int
+	decompressed int
+}
+
+func (c *countingCompressor) Compress(data []byte) ([]byte, error) {
+	c.compressed++
+	return c.GzipCompressor.Compress(data)
+}
+
+func (c *countingCompressor) Decompress(data []byte) ([]byte, error) {
+	c.decompressed++
+	return c.GzipCompressor.Decompress(data)
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	for threshold, expected := range map[uint64]int{0: 1, cache.DefaultCompressionThreshold: 0} {
+		compressor := &countingCompressor{}
+		c := gotcha.New(gotcha.NewOption().SetCompression(compressor, threshold))
+		err := c.Set("key-1", "small")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if compressor.compressed != expected {
+			t.Fatalf("expected: %v, got %v", expected, compressor.compressed)
+		}
+	}
+}
+
+func TestCompressionRemoval(t *testing.T) {
+	compressor := &countingCompressor{}
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(1).SetCompression(compressor, 0))
+	for _, key := range []string{"key-1", "key-2"} {
+		err := c.SetWithTags(key, key, "tag")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	err := c.Delete("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The evicted and deleted values are not decompressed
+	if compressor.decompressed != 0 {
+		t.Fatalf("expected: %v, got %v", 0, compressor.decompressed)
+	}
+	invalidated, err := c.InvalidateTag("tag")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if invalidated != 0 {
+		t.Fatalf("expected: %v, got %v", 0, invalidated)
+	}
+}
+
+func TestCompressionMetadata(t *testing.T) {
+	compressor := &countingCompressor{}
+	c := gotcha.New(gotcha.NewOption().SetCompression(compressor, 0))
+	ns := c.Namespace("users")
+	ns.SetQuota(1)
+	for _, key := range []string{"key-1", "key-2"} {
+		err := ns.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// Walking the keys, the expiry times and the namespace quota doesn't decompress the values
+	var keys []string
+	for key := range c.Keys() {
+		keys = append(keys, key)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected: %v, got %v", 1, len(keys))
+	}
+	_, err := c.ExpiryStats()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if compressor.decompressed != 0 {
+		t.Fatalf("expected: %v, got %v", 0, compressor.decompressed)
+	}
+}
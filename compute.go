@@ -0,0 +1,101 @@
+package gotcha
+
+import (
+	"errors"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// Update will atomically replace the value of the item with the value returned by fn.
+// fn receives the current value and whether the item exists (an expired item doesn't exist),
+// returning keep false will remove the item. The existing item keeps its expiry time,
+// the new item uses the default expiry time.
+// fn is called under the cache lock, so it must not call the cache
+func (c *Cache) Update(key string, fn cache.UpdateFunc) (err error) {
+	return c.compute(key, func(current *cache.Document) (value interface{}, keep bool, err error) {
+		if current == nil {
+			value, keep = fn(nil, false)
+			return
+		}
+		value, keep = fn(current.Value, true)
+		return
+	})
+}
+
+// ComputeIfAbsent will return the value of the item if it exists, otherwise store and return the value
+// computed by fn. Nothing is stored if fn returns an error.
+// fn is called under the cache lock, so it must not call the cache
+func (c *Cache) ComputeIfAbsent(key string, fn func(key string) (interface{}, error)) (val interface{}, err error) {
+	err = c.compute(key, func(current *cache.Document) (value interface{}, keep bool, err error) {
+		if current != nil {
+			val = current.Value
+			return nil, true, errUnchanged
+		}
+		val, err = fn(key)
+		return val, true, err
+	})
+	if err == errUnchanged {
+		return val, nil
+	}
+	if err != nil {
+		return
+	}
+	return c.isolateStored(val)
+}
+
+// ComputeIfPresent will replace the value of the existing item with the value computed by fn,
+// returning keep false will remove the item. It returns cache.ErrMissed if the item doesn't exist.
+// fn is called under the cache lock, so it must not call the cache
+func (c *Cache) ComputeIfPresent(key string, fn func(key string, old interface{}) (newValue interface{}, keep bool)) (
+	val interface{}, err error) {
+	err = c.compute(key, func(current *cache.Document) (value interface{}, keep bool, err error) {
+		if current == nil {
+			return nil, false, cache.ErrMissed
+		}
+		value, keep = fn(key, current.Value)
+		if keep {
+			val = value
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	return c.isolateStored(val)
+}
+
+// errUnchanged is returned by the compute function to leave the item as is
+var errUnchanged = errors.New("unchanged")
+
+// compute runs fn under the cache lock with the current non expired document, or nil if it's missing.
+// The value returned by fn is stored with the expiry time and the tags of the current document,
+// or the default expiry time.
+// Returning keep false will remove the item, and returning an error will leave the item as is
+func (c *Cache) compute(key string, fn func(current *cache.Document) (value interface{}, keep bool, err error)) (err error) {
+	document := c.newDocument(key, nil)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	current, errPeek := c.peek(key)
+	if errPeek != nil {
+		current = nil
+	}
+	value, keep, err := fn(current)
+	if err != nil {
+		return
+	}
+	if !keep {
+		if current != nil {
+			_, err = c.remove(key)
+		}
+		return
+	}
+
+	document.Value = value
+	if current != nil {
+		document.StoredTime = current.StoredTime
+		document.TTL = current.TTL
+		document.Tags = current.Tags
+	}
+	return c.store(document)
+}
@@ -0,0 +1,255 @@
+package gotcha_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestUpdate(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute))
+
+	t.Run("missing", func(t *testing.T) {
+		err := c.Update("houses", func(old interface{}, exists bool) (interface{}, bool) {
+			if exists {
+				t.Fatalf("expected: %v, got %v", false, exists)
+			}
+			return []string{"Stark"}, true
+		})
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		err := c.Touch("houses", time.Hour)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.Update("houses", func(old interface{}, exists bool) (interface{}, bool) {
+			return append(old.([]string), "Targaryen"), true
+		})
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		val, err := c.Get("houses")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if fmt.Sprint(val) != "[Stark Targaryen]" {
+			t.Fatalf("expected: %v, got %v", "[Stark Targaryen]", val)
+		}
+		// The expiry time is kept
+		ttl, err := c.TTL("houses")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl < time.Hour-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "around an hour", ttl)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		err := c.Update("houses", func(old interface{}, exists bool) (interface{}, bool) {
+			return nil, false
+		})
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Get("houses")
+		if err != cache.ErrMissed {
+			t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		err := c.Set("name", "John Snow")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.Touch("name", time.Nanosecond)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.Update("name", func(old interface{}, exists bool) (interface{}, bool) {
+			if exists {
+				t.Fatalf("expected: %v, got %v", false, exists)
+			}
+			return "Arya Stark", true
+		})
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		ttl, err := c.TTL("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl < time.Minute-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "default expiry time", ttl)
+		}
+	})
+}
+
+func TestComputeIfAbsent(t *testing.T) {
+	c := gotcha.New()
+	counter := 0
+	compute := func(key string) (interface{}, error) {
+		counter++
+		return "John Snow", nil
+	}
+	for i := 0; i < 3; i++ {
+		val, err := c.ComputeIfAbsent("name", compute)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != "John Snow" {
+			t.Fatalf("expected: %v, got %v", "John Snow", val)
+		}
+	}
+	if counter != 1 {
+		t.Fatalf("expected: %v, got %v", 1, counter)
+	}
+
+	errCompute := errors.New("compute error")
+	_, err := c.ComputeIfAbsent("kingdom", func(key string) (interface{}, error) {
+		return nil, errCompute
+	})
+	if err != errCompute {
+		t.Fatalf("expected: %v, got %v", errCompute, err)
+	}
+	_, err = c.Get("kingdom")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestComputeIfPresent(t *testing.T) {
+	c := gotcha.New()
+	_, err := c.ComputeIfPresent("name", func(key string, old interface{}) (interface{}, bool) {
+		t.Fatalf("expected: %v, got %v", "not called", "called")
+		return nil, true
+	})
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+
+	err = c.Set("name", "John")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.ComputeIfPresent("name", func(key string, old interface{}) (interface{}, bool) {
+		return old.(string) + " Snow", true
+	})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "John Snow" {
+		t.Fatalf("expected: %v, got %v", "John Snow", val)
+	}
+
+	_, err = c.ComputeIfPresent("name", func(key string, old interface{}) (interface{}, bool) {
+		return nil, false
+	})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.Get("name")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestUpdateWithEviction(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(2))
+			for _, key := range []string{"key-1", "key-2", "key-3"} {
+				err := c.Update(key, func(old interface{}, exists bool) (interface{}, bool) {
+					return key, true
+				})
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			keys, err := c.GetKeys()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(keys) != 2 {
+				t.Fatalf("expected: %v, got %v", 2, len(keys))
+			}
+			_, err = c.Get("key-1")
+			if err != cache.ErrMissed {
+				t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+			}
+		})
+	}
+}
+
+func TestUpdateWithMaxMemory(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxMemory(300))
+			for _, key := range []string{"key-1", "key-2"} {
+				err := c.Set(key, key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+
+			// Growing the existing item evicts the other item
+			err := c.Update("key-2", func(old interface{}, exists bool) (interface{}, bool) {
+				return strings.Repeat("x", 1000), true
+			})
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			keys, err := c.GetKeys()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if !reflect.DeepEqual(keys, []string{"key-2"}) {
+				t.Fatalf("expected: %v, got %v", []string{"key-2"}, keys)
+			}
+		})
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm))
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					err := c.Update("items", func(old interface{}, exists bool) (interface{}, bool) {
+						if !exists {
+							return []int{i}, true
+						}
+						return append(old.([]int), i), true
+					})
+					if err != nil {
+						t.Errorf("expected: %v, got %v", nil, err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			val, err := c.Get("items")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(val.([]int)) != 100 {
+				t.Fatalf("expected: %v, got %v", 100, len(val.([]int)))
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package gotcha
+
+import (
+	"math"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// Increment will atomically add delta to the integer value of the item and return the new value.
+// The missing item is created with the default expiry time, the existing item keeps its expiry time.
+// The value is stored as int64, a non integer value returns *cache.NotNumericError
+func (c *Cache) Increment(key string, delta int64) (val int64, err error) {
+	err = c.updateNumber(key, func(current interface{}) (interface{}, error) {
+		if current == nil {
+			val = delta
+			return val, nil
+		}
+		number, ok := toInt64(current)
+		if !ok {
+			return nil, &cache.NotNumericError{Key: key, Value: current}
+		}
+		if (delta > 0 && number > math.MaxInt64-delta) || (delta < 0 && number < math.MinInt64-delta) {
+			return nil, cache.ErrOverflow
+		}
+		val = number + delta
+		return val, nil
+	})
+	return
+}
+
+// Decrement will atomically subtract delta from the integer value of the item, see Increment
+func (c *Cache) Decrement(key string, delta int64) (val int64, err error) {
+	if delta == math.MinInt64 {
+		return 0, cache.ErrOverflow
+	}
+	return c.Increment(key, -delta)
+}
+
+// IncrementFloat will atomically add delta to the numeric value of the item and return the new value.
+// The missing item is created with the default expiry time, the existing item keeps its expiry time.
+// The value is stored as float64, a non numeric value returns *cache.NotNumericError
+func (c *Cache) IncrementFloat(key string, delta float64) (val float64, err error) {
+	err = c.updateNumber(key, func(current interface{}) (interface{}, error) {
+		if current == nil {
+			val = delta
+			return val, nil
+		}
+		number, ok := toFloat64(current)
+		if !ok {
+			return nil, &cache.NotNumericError{Key: key, Value: current}
+		}
+		val = number + delta
+		return val, nil
+	})
+	return
+}
+
+// DecrementFloat will atomically subtract delta from the numeric value of the item, see IncrementFloat
+func (c *Cache) DecrementFloat(key string, delta float64) (val float64, err error) {
+	return c.IncrementFloat(key, -delta)
+}
+
+// updateNumber will store the value returned by fn, fn receives nil if the item is missing
+func (c *Cache) updateNumber(key string, fn func(current interface{}) (interface{}, error)) (err error) {
+	return c.compute(key, func(current *cache.Document) (value interface{}, keep bool, err error) {
+		if current == nil {
+			value, err = fn(nil)
+		} else {
+			value, err = fn(current.Value)
+		}
+		return value, true, err
+	})
+}
+
+func toInt64(value interface{}) (number int64, ok bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (number float64, ok bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	if integer, ok := toInt64(value); ok {
+		return float64(integer), true
+	}
+	return 0, false
+}
@@ -0,0 +1,182 @@
+package gotcha_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestIncrement(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute))
+
+	t.Run("missing", func(t *testing.T) {
+		val, err := c.Increment("counter", 5)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != 5 {
+			t.Fatalf("expected: %v, got %v", 5, val)
+		}
+		ttl, err := c.TTL("counter")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl > time.Minute || ttl < time.Minute-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "default expiry time", ttl)
+		}
+	})
+
+	t.Run("existing", func(t *testing.T) {
+		err := c.Touch("counter", time.Hour)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		val, err := c.Decrement("counter", 7)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != -2 {
+			t.Fatalf("expected: %v, got %v", -2, val)
+		}
+		stored, err := c.Get("counter")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if stored != int64(-2) {
+			t.Fatalf("expected: %v, got %v", int64(-2), stored)
+		}
+		// The expiry time is kept
+		ttl, err := c.TTL("counter")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl < time.Hour-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "around an hour", ttl)
+		}
+	})
+
+	t.Run("other-integer-type", func(t *testing.T) {
+		err := c.Set("visitor", uint8(10))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		val, err := c.Increment("visitor", 1)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != 11 {
+			t.Fatalf("expected: %v, got %v", 11, val)
+		}
+	})
+
+	t.Run("not-numeric", func(t *testing.T) {
+		err := c.Set("name", "John Snow")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Increment("name", 1)
+		numericErr, ok := err.(*cache.NotNumericError)
+		if !ok {
+			t.Fatalf("expected: %v, got %v", "*cache.NotNumericError", err)
+		}
+		if numericErr.Key != "name" {
+			t.Fatalf("expected: %v, got %v", "name", numericErr.Key)
+		}
+
+		err = c.Set("ratio", 0.5)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Increment("ratio", 1)
+		if _, ok := err.(*cache.NotNumericError); !ok {
+			t.Fatalf("expected: %v, got %v", "*cache.NotNumericError", err)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		err := c.Set("max", int64(math.MaxInt64))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Increment("max", 1)
+		if err != cache.ErrOverflow {
+			t.Fatalf("expected: %v, got %v", cache.ErrOverflow, err)
+		}
+		val, err := c.Get("max")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != int64(math.MaxInt64) {
+			t.Fatalf("expected: %v, got %v", int64(math.MaxInt64), val)
+		}
+	})
+}
+
+func TestIncrementFloat(t *testing.T) {
+	c := gotcha.New()
+	val, err := c.IncrementFloat("ratio", 0.5)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != 0.5 {
+		t.Fatalf("expected: %v, got %v", 0.5, val)
+	}
+	val, err = c.DecrementFloat("ratio", 0.25)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != 0.25 {
+		t.Fatalf("expected: %v, got %v", 0.25, val)
+	}
+
+	err = c.Set("counter", 2)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err = c.IncrementFloat("counter", 0.5)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != 2.5 {
+		t.Fatalf("expected: %v, got %v", 2.5, val)
+	}
+
+	err = c.Set("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.IncrementFloat("name", 1)
+	if _, ok := err.(*cache.NotNumericError); !ok {
+		t.Fatalf("expected: %v, got %v", "*cache.NotNumericError", err)
+	}
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm))
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := c.Increment("counter", 1); err != nil {
+						t.Errorf("expected: %v, got %v", nil, err)
+					}
+				}()
+			}
+			wg.Wait()
+			val, err := c.Increment("counter", 0)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != 100 {
+				t.Fatalf("expected: %v, got %v", 100, val)
+			}
+		})
+	}
+}
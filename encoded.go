@@ -0,0 +1,142 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
+)
+
+// valueTransform transforms the encoded value of the document before it's stored, and reverts it after it's read.
+// The transform may keep its metadata in the document, e.g the encryption key ID
+type valueTransform interface {
+	apply(doc *cache.Document, data []byte) ([]byte, error)
+	revert(doc *cache.Document, data []byte) ([]byte, error)
+}
+
+// encodedRepository stores the values encoded by the codec and the transforms in order, e.g compressed,
+// and decodes them on read, so the cache deals with the values as is. The listeners are called with
+// the stored documents
+type encodedRepository struct {
+	internal.Repository
+	codec      cache.Codec
+	transforms []valueTransform
+}
+
+// encode returns a copy of the document with the encoded value
+func (r *encodedRepository) encode(doc *cache.Document) (*cache.Document, error) {
+	data, err := MarshalValue(r.codec, doc.Value)
+	if err != nil {
+		return nil, err
+	}
+	encoded := *doc
+	for _, t := range r.transforms {
+		if data, err = t.apply(&encoded, data); err != nil {
+			return nil, err
+		}
+	}
+	encoded.Value = data
+	return &encoded, nil
+}
+
+// decode returns a copy of the document with the decoded value
+func (r *encodedRepository) decode(doc *cache.Document) (*cache.Document, error) {
+	data, ok := doc.Value.([]byte)
+	if !ok {
+		return nil, cache.ErrUnsupportedValue
+	}
+	var err error
+	for i := len(r.transforms) - 1; i >= 0; i-- {
+		if data, err = r.transforms[i].revert(doc, data); err != nil {
+			return nil, err
+		}
+	}
+	value, err := UnmarshalValue(r.codec, data)
+	if err != nil {
+		return nil, err
+	}
+	decoded := *doc
+	decoded.Value = value
+	return &decoded, nil
+}
+
+func (r *encodedRepository) Set(doc *cache.Document) (err error) {
+	encoded, err := r.encode(doc)
+	if err != nil {
+		return
+	}
+	err = r.Repository.Set(encoded)
+	// The repository may set the expiry time
+	doc.TTL = encoded.TTL
+	return
+}
+
+func (r *encodedRepository) SetWithFrequency(doc *cache.Document, frequency uint64) (err error) {
+	encoded, err := r.encode(doc)
+	if err != nil {
+		return
+	}
+	err = r.Repository.SetWithFrequency(encoded, frequency)
+	doc.TTL = encoded.TTL
+	return
+}
+
+func (r *encodedRepository) Get(key string) (res *cache.Document, err error) {
+	res, err = r.Repository.Get(key)
+	if err != nil {
+		return
+	}
+	return r.decode(res)
+}
+
+func (r *encodedRepository) Peek(key string) (res *cache.Document, err error) {
+	res, err = r.Repository.Peek(key)
+	if err != nil {
+		return
+	}
+	return r.decode(res)
+}
+
+func (r *encodedRepository) PopOldest() (res *cache.Document, err error) {
+	res, err = r.Repository.PopOldest()
+	if err != nil {
+		return
+	}
+	return r.decode(res)
+}
+
+func (r *encodedRepository) PopLeastFrequent() (res *cache.Document, err error) {
+	res, err = r.Repository.PopLeastFrequent()
+	if err != nil {
+		return
+	}
+	return r.decode(res)
+}
+
+// Range skips the documents failing to decode. The callers reading only the metadata use RangeMetadata
+// of the repository instead, which doesn't decode the values
+func (r *encodedRepository) Range(fn func(doc *cache.Document) bool) {
+	r.Repository.Range(func(doc *cache.Document) bool {
+		decoded, err := r.decode(doc)
+		if err != nil {
+			return true
+		}
+		return fn(decoded)
+	})
+}
+
+// decodeStored decodes the document passed to the listeners, since they're called with the stored document
+// so the removed documents are not decoded only to drop their tags
+func (c *Cache) decodeStored(doc *cache.Document) (*cache.Document, error) {
+	if repo, ok := c.repo.(*encodedRepository); ok {
+		return repo.decode(doc)
+	}
+	return doc, nil
+}
+
+// storedSizer measures the document by the size of its key and stored value
+func storedSizer(doc *cache.Document) (uint64, error) {
+	data, ok := doc.Value.([]byte)
+	if !ok {
+		return 0, cache.ErrUnsupportedValue
+	}
+	return uint64(len(doc.Key) + len(data)), nil
+}
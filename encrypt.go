@@ -0,0 +1,167 @@
+package gotcha
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// keyring encrypts the data with AES-GCM using the primary key, prefixed by the nonce and authenticated
+// with the key ID, and decrypts the data with the key of the ID
+type keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// newKeyring returns the error of the invalid keys, e.g the AES key not of 16, 24 or 32 bytes
+func newKeyring(keys []cache.EncryptionKey) (*keyring, error) {
+	k := &keyring{aeads: map[string]cipher.AEAD{}}
+	for i, key := range keys {
+		if len(key.ID) > 255 {
+			return nil, cache.ErrEncryptionKeyID
+		}
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			k.primary = key.ID
+		}
+		k.aeads[key.ID] = aead
+	}
+	return k, nil
+}
+
+// mustKeyring panics with the error of the invalid keys, so the cache fails on New instead of every write
+func mustKeyring(keys []cache.EncryptionKey) *keyring {
+	k, err := newKeyring(keys)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// seal encrypts the data as [nonce][ciphertext] with the primary key, and returns the key ID
+func (k *keyring) seal(data []byte) (id string, sealed []byte, err error) {
+	aead := k.aeads[k.primary]
+	sealed = make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, sealed); err != nil {
+		return
+	}
+	// Authenticate the key ID as well
+	return k.primary, aead.Seal(sealed, sealed, data, []byte(k.primary)), nil
+}
+
+// open decrypts the data sealed by the key of the ID, it returns cache.ErrEncryptionKey if the key is missing
+func (k *keyring) open(id string, sealed []byte) ([]byte, error) {
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, cache.ErrEncryptionKey
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, cache.ErrUnsupportedValue
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+}
+
+// apply encrypts the value, and keeps the key ID in the document
+func (k *keyring) apply(doc *cache.Document, data []byte) ([]byte, error) {
+	id, sealed, err := k.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	doc.KeyID = id
+	return sealed, nil
+}
+
+func (k *keyring) revert(doc *cache.Document, data []byte) ([]byte, error) {
+	return k.open(doc.KeyID, data)
+}
+
+// sealedSnapshotCodec encrypts every record encoded by the codec, as the frames of the length, the key ID
+// and the sealed record, so the snapshots, the append only file and the disk tier are encrypted
+type sealedSnapshotCodec struct {
+	codec cache.SnapshotCodec
+	keys  *keyring
+}
+
+// NewEncoder return the encoder writing the sealed frames to w
+func (s sealedSnapshotCodec) NewEncoder(w io.Writer) cache.Encoder {
+	e := &sealingEncoder{w: w, keys: s.keys}
+	e.enc = s.codec.NewEncoder(&e.buf)
+	return e
+}
+
+// NewDecoder return the decoder reading the sealed frames from r
+func (s sealedSnapshotCodec) NewDecoder(r io.Reader) cache.Decoder {
+	return s.codec.NewDecoder(&openingReader{r: r, keys: s.keys})
+}
+
+type sealingEncoder struct {
+	w    io.Writer
+	buf  bytes.Buffer
+	enc  cache.Encoder
+	keys *keyring
+}
+
+func (e *sealingEncoder) Encode(v interface{}) (err error) {
+	e.buf.Reset()
+	if err = e.enc.Encode(v); err != nil {
+		return
+	}
+	id, sealed, err := e.keys.seal(e.buf.Bytes())
+	if err != nil {
+		return
+	}
+	// [length][ID length][ID][nonce][ciphertext]
+	header := make([]byte, 4+1+len(id))
+	binary.BigEndian.PutUint32(header, uint32(1+len(id)+len(sealed)))
+	header[4] = byte(len(id))
+	copy(header[5:], id)
+	if _, err = e.w.Write(header); err != nil {
+		return
+	}
+	_, err = e.w.Write(sealed)
+	return
+}
+
+// openingReader reads the records decrypted from the sealed frames
+type openingReader struct {
+	r    io.Reader
+	keys *keyring
+	buf  []byte
+}
+
+func (o *openingReader) Read(p []byte) (n int, err error) {
+	for len(o.buf) == 0 {
+		var header [4]byte
+		if _, err = io.ReadFull(o.r, header[:]); err != nil {
+			return
+		}
+		sealed := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err = io.ReadFull(o.r, sealed); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		if len(sealed) == 0 || len(sealed) < 1+int(sealed[0]) {
+			return 0, cache.ErrUnsupportedValue
+		}
+		if o.buf, err = o.keys.open(string(sealed[1:1+sealed[0]]), sealed[1+sealed[0]:]); err != nil {
+			return
+		}
+	}
+	n = copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return
+}
@@ -0,0 +1,172 @@
+package gotcha_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+var (
+	encryptionKey1 = cache.EncryptionKey{ID: "key-1", Key: bytes.Repeat([]byte{1}, 32)}
+	encryptionKey2 = cache.EncryptionKey{ID: "key-2", Key: bytes.Repeat([]byte{2}, 16)}
+)
+
+func TestEncryption(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm, cache.ArenaAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetEncryptionKeys(encryptionKey1).
+				SetCompression(gotcha.GzipCompressor{}, 1))
+			err := c.Set("ssn", "123-45-6789")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			val, err := c.Get("ssn")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "123-45-6789" {
+				t.Fatalf("expected: %v, got %v", "123-45-6789", val)
+			}
+
+			// The snapshot doesn't contain the plaintext key and value
+			var buf bytes.Buffer
+			err = c.Save(&buf)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if bytes.Contains(buf.Bytes(), []byte("ssn")) || bytes.Contains(buf.Bytes(), []byte("123-45-6789")) {
+				t.Fatalf("expected: %v, got %v", "encrypted", buf.String())
+			}
+			snapshot := buf.Bytes()
+
+			restored := gotcha.New(gotcha.NewOption().SetEncryptionKeys(encryptionKey1))
+			err = restored.Load(bytes.NewReader(snapshot))
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			val, err = restored.Get("ssn")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "123-45-6789" {
+				t.Fatalf("expected: %v, got %v", "123-45-6789", val)
+			}
+
+			// The snapshot can't be loaded without the key
+			err = gotcha.New().Load(bytes.NewReader(snapshot))
+			if err == nil {
+				t.Fatalf("expected: %v, got %v", "error", err)
+			}
+		})
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetEncryptionKeys(encryptionKey1))
+	err := c.Set("ssn", "123-45-6789")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	var buf bytes.Buffer
+	err = c.Save(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The snapshot encrypted by the previous key is loaded, and saved with the new primary key
+	rotated := gotcha.New(gotcha.NewOption().SetEncryptionKeys(encryptionKey2, encryptionKey1))
+	err = rotated.Load(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	buf.Reset()
+	err = rotated.Save(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	snapshot := buf.Bytes()
+
+	restored := gotcha.New(gotcha.NewOption().SetEncryptionKeys(encryptionKey2))
+	err = restored.Load(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := restored.Get("ssn")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "123-45-6789" {
+		t.Fatalf("expected: %v, got %v", "123-45-6789", val)
+	}
+
+	err = gotcha.New(gotcha.NewOption().SetEncryptionKeys(encryptionKey1)).Load(bytes.NewReader(snapshot))
+	if err != cache.ErrEncryptionKey {
+		t.Fatalf("expected: %v, got %v", cache.ErrEncryptionKey, err)
+	}
+}
+
+func TestEncryptionAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newAOFOption(t, path).SetEncryptionKeys(encryptionKey1))
+	err := c.Set("ssn", "123-45-6789")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if bytes.Contains(data, []byte("123-45-6789")) {
+		t.Fatalf("expected: %v, got %v", "encrypted", string(data))
+	}
+
+	restored := gotcha.New(newAOFOption(t, path).SetEncryptionKeys(encryptionKey1))
+	defer restored.Close()
+	val, err := restored.Get("ssn")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "123-45-6789" {
+		t.Fatalf("expected: %v, got %v", "123-45-6789", val)
+	}
+}
+
+func TestEncryptionInvalidKey(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected: %v, got %v", "panic", r)
+		}
+	}()
+	gotcha.New(gotcha.NewOption().SetEncryptionKeys(cache.EncryptionKey{ID: "key", Key: []byte("short")}))
+}
+
+func TestEncryptionKeyID(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetAlgorithm(cache.ArenaAlgorithm).SetEncryptionKeys(encryptionKey1))
+	err := c.SetWithTags("ssn", "123-45-6789", "tag")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// The key ID is kept by the arena, beside the value
+	val, err := c.Get("ssn")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "123-45-6789" {
+		t.Fatalf("expected: %v, got %v", "123-45-6789", val)
+	}
+	invalidated, err := c.InvalidateTag("tag")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if invalidated != 1 {
+		t.Fatalf("expected: %v, got %v", 1, invalidated)
+	}
+}
@@ -0,0 +1,179 @@
+package gotcha
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// bytesType is the type name of the []byte values in the export, so they're not imported as the base64 strings
+const bytesType = "[]byte"
+
+// exportItem is a line of the JSON Lines export
+type exportItem struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt *time.Time      `json:"expires_at"` // null if the item never expires
+	Metadata  exportMetadata  `json:"metadata"`
+}
+
+type exportMetadata struct {
+	StoredAt time.Time `json:"stored_at"`
+	Tags     []string  `json:"tags,omitempty"`
+	Type     string    `json:"type,omitempty"` // the name of the type registered with RegisterType
+}
+
+// matchFilter return whether the key is selected by the filter, the pattern must be valid
+func matchFilter(filter cache.KeyFilter, key string) bool {
+	if !strings.HasPrefix(key, filter.Prefix) {
+		return false
+	}
+	if filter.Pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(filter.Pattern, key)
+	return matched
+}
+
+// Export will write the non expired items selected by the filter to w as JSON Lines, one item per line with
+// its key, value, expiry time and metadata, and return the number of exported items. The items in the disk tier
+// are exported as well.
+// The items are read one by one under the read lock and written without holding the lock, so the export
+// isn't buffered in the memory, but the items changed during the export may be exported or not
+func (c *Cache) Export(w io.Writer, filter cache.KeyFilter) (exported int, err error) {
+	if _, err = path.Match(filter.Pattern, ""); err != nil {
+		return
+	}
+	prefix := filter.Prefix
+	if literal := literalPrefix(filter.Pattern); len(literal) > len(prefix) {
+		prefix = literal
+	}
+
+	c.mutex.RLock()
+	keys := c.keysWithPrefix(prefix)
+	c.mutex.RUnlock()
+
+	enc := json.NewEncoder(w)
+	for _, key := range keys {
+		if !matchFilter(filter, key) {
+			continue
+		}
+		c.mutex.RLock()
+		doc, errPeek := c.peek(key)
+		c.mutex.RUnlock()
+		if errPeek != nil {
+			// Deleted or expired since
+			continue
+		}
+
+		item := exportItem{
+			Key: doc.Key,
+			Metadata: exportMetadata{
+				StoredAt: time.Unix(doc.StoredTime, 0).UTC(),
+				Tags:     doc.Tags,
+				Type:     exportType(doc.Value),
+			},
+		}
+		if doc.TTL != cache.NoExpiration {
+			expiresAt := doc.ExpiresAt().UTC()
+			item.ExpiresAt = &expiresAt
+		}
+		if item.Value, err = json.Marshal(doc.Value); err != nil {
+			return
+		}
+		// The encoder writes every item as a line
+		if err = enc.Encode(item); err != nil {
+			return
+		}
+		exported++
+	}
+	return
+}
+
+// exportType return the name of the registered type of the value, or empty if it's not registered
+func exportType(value interface{}) string {
+	if _, ok := value.([]byte); ok {
+		return bytesType
+	}
+	typeRegistry.RLock()
+	defer typeRegistry.RUnlock()
+	return typeRegistry.byType[reflect.TypeOf(value)]
+}
+
+// Import will read the JSON Lines written by Export from r, and store the items selected by the filter
+// with their stored time, expiry time and tags, and return the number of imported items. The items are stored one by one,
+// the existing items with the same keys are replaced, and the expired items are skipped.
+// The values of the types registered with RegisterType are decoded to the types, the others are decoded
+// as the JSON types, e.g the numbers are decoded as float64
+func (c *Cache) Import(r io.Reader, filter cache.KeyFilter) (imported int, err error) {
+	if _, err = path.Match(filter.Pattern, ""); err != nil {
+		return
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var item exportItem
+		if err = dec.Decode(&item); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if !matchFilter(filter, item.Key) {
+			continue
+		}
+
+		var value interface{}
+		if value, err = importValue(item); err != nil {
+			return
+		}
+		doc := c.newDocument(item.Key, value)
+		doc.Tags = item.Metadata.Tags
+		if !item.Metadata.StoredAt.IsZero() {
+			doc.StoredTime = item.Metadata.StoredAt.Unix()
+		}
+		doc.TTL = cache.NoExpiration
+		if item.ExpiresAt != nil {
+			doc.TTL = item.ExpiresAt.Sub(time.Unix(doc.StoredTime, 0))
+			if doc.TTL <= 0 || doc.IsExpired() {
+				continue
+			}
+		}
+
+		c.mutex.Lock()
+		err = c.store(doc)
+		c.mutex.Unlock()
+		if err != nil {
+			return
+		}
+		imported++
+	}
+}
+
+// importValue decodes the value of the item to its registered type
+func importValue(item exportItem) (value interface{}, err error) {
+	if item.Metadata.Type == "" {
+		err = json.Unmarshal(item.Value, &value)
+		return
+	}
+
+	t := reflect.TypeOf([]byte(nil))
+	if item.Metadata.Type != bytesType {
+		typeRegistry.RLock()
+		registered, ok := typeRegistry.byName[item.Metadata.Type]
+		typeRegistry.RUnlock()
+		if !ok {
+			return nil, cache.ErrUnsupportedValue
+		}
+		t = registered
+	}
+	ptr := reflect.New(t)
+	if err = json.Unmarshal(item.Value, ptr.Interface()); err != nil {
+		return
+	}
+	return ptr.Elem().Interface(), nil
+}
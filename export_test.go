@@ -0,0 +1,246 @@
+package gotcha_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+type exportUser struct {
+	Name string
+	Age  int
+}
+
+func TestExportAndImport(t *testing.T) {
+	gotcha.RegisterType("export-user", exportUser{})
+	c := gotcha.New()
+	err := c.SetWithTags("user:1", exportUser{Name: "john", Age: 30}, "users")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Set("page:1", []byte("<html></html>"))
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Set("count", 1)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Persist("count")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	var buf bytes.Buffer
+	exported, err := c.Export(&buf, cache.KeyFilter{})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if exported != 3 {
+		t.Fatalf("expected: %v, got %v", 3, exported)
+	}
+
+	// Every line is a JSON object
+	lines := map[string]map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		lines[line["key"].(string)] = line
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected: %v, got %v", 3, len(lines))
+	}
+	if lines["count"]["expires_at"] != nil {
+		t.Fatalf("expected: %v, got %v", nil, lines["count"]["expires_at"])
+	}
+	if lines["user:1"]["expires_at"] == nil {
+		t.Fatalf("expected: %v, got %v", "expiry time", nil)
+	}
+	expected := map[string]interface{}{"Name": "john", "Age": float64(30)}
+	if !reflect.DeepEqual(lines["user:1"]["value"], expected) {
+		t.Fatalf("expected: %v, got %v", expected, lines["user:1"]["value"])
+	}
+
+	restored := gotcha.New()
+	imported, err := restored.Import(&buf, cache.KeyFilter{})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if imported != 3 {
+		t.Fatalf("expected: %v, got %v", 3, imported)
+	}
+	val, err := restored.Get("user:1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != (exportUser{Name: "john", Age: 30}) {
+		t.Fatalf("expected: %v, got %v", exportUser{Name: "john", Age: 30}, val)
+	}
+	val, err = restored.Get("page:1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(val, []byte("<html></html>")) {
+		t.Fatalf("expected: %v, got %v", "<html></html>", val)
+	}
+	// The unregistered types are imported as the JSON types
+	val, err = restored.Get("count")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != float64(1) {
+		t.Fatalf("expected: %v, got %v", 1, val)
+	}
+	ttl, err := restored.TTL("count")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if ttl != cache.NoExpiration {
+		t.Fatalf("expected: %v, got %v", cache.NoExpiration, ttl)
+	}
+	deleted, err := restored.InvalidateTag("users")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected: %v, got %v", 1, deleted)
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	c := gotcha.New()
+	for _, key := range []string{"user:1", "user:2", "session:1", "user:admin"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		filter   cache.KeyFilter
+		expected []string
+	}{
+		{cache.KeyFilter{Prefix: "user:"}, []string{"user:1", "user:2", "user:admin"}},
+		{cache.KeyFilter{Pattern: "*:1"}, []string{"session:1", "user:1"}},
+		{cache.KeyFilter{Prefix: "user:", Pattern: "user:[0-9]"}, []string{"user:1", "user:2"}},
+	} {
+		var buf bytes.Buffer
+		_, err := c.Export(&buf, tc.filter)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		var keys []string
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var item struct{ Key string }
+			if err = json.Unmarshal([]byte(line), &item); err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			keys = append(keys, item.Key)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, tc.expected) {
+			t.Fatalf("expected: %v, got %v", tc.expected, keys)
+		}
+	}
+
+	_, err := c.Export(&bytes.Buffer{}, cache.KeyFilter{Pattern: "["})
+	if err != path.ErrBadPattern {
+		t.Fatalf("expected: %v, got %v", path.ErrBadPattern, err)
+	}
+}
+
+func TestImportFilter(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	input := `{"key":"user:1","value":"john","expires_at":null,"metadata":{"tags":["users"]}}
+{"key":"user:2","value":"jane","expires_at":"` + expired + `","metadata":{}}
+{"key":"session:1","value":"abc","expires_at":null,"metadata":{}}
+`
+	c := gotcha.New()
+	imported, err := c.Import(strings.NewReader(input), cache.KeyFilter{Prefix: "user:"})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// user:2 is expired, and session:1 is filtered
+	if imported != 1 {
+		t.Fatalf("expected: %v, got %v", 1, imported)
+	}
+	keys, err := c.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"user:1"}) {
+		t.Fatalf("expected: %v, got %v", []string{"user:1"}, keys)
+	}
+
+	_, err = c.Import(strings.NewReader(`{"key":`), cache.KeyFilter{})
+	if err == nil {
+		t.Fatalf("expected: %v, got %v", "error", err)
+	}
+}
+
+func TestImportStoredTime(t *testing.T) {
+	now := time.Now().UTC()
+	lines := []string{
+		`{"key":"key-1","value":1,"expires_at":"` + now.Add(time.Minute).Format(time.RFC3339) + `",` +
+			`"metadata":{"stored_at":"` + now.Add(-time.Minute).Format(time.RFC3339) + `"}}`,
+		`{"key":"key-2","value":2,"expires_at":"` + now.Add(-time.Minute).Format(time.RFC3339) + `",` +
+			`"metadata":{"stored_at":"` + now.Add(-2*time.Minute).Format(time.RFC3339) + `"}}`,
+	}
+	c := gotcha.New()
+	imported, err := c.Import(strings.NewReader(strings.Join(lines, "\n")), cache.KeyFilter{})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if imported != 1 {
+		t.Fatalf("expected: %v, got %v", 1, imported)
+	}
+
+	// The stored time is restored, so the item keeps its expiry time
+	ttl, err := c.TTL("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if ttl > time.Minute || ttl < 58*time.Second {
+		t.Fatalf("expected: %v, got %v", time.Minute, ttl)
+	}
+	var buf bytes.Buffer
+	_, err = c.Export(&buf, cache.KeyFilter{})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !strings.Contains(buf.String(), now.Add(-time.Minute).Format(time.RFC3339)) {
+		t.Fatalf("expected: %v, got %v", "stored_at", buf.String())
+	}
+}
+
+func TestExportDiskTier(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(1).SetDiskTier(t.TempDir()))
+	defer c.Close()
+	for _, key := range []string{"key-1", "key-2"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	// key-1 is exported from the disk tier
+	var buf bytes.Buffer
+	exported, err := c.Export(&buf, cache.KeyFilter{})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if exported != 2 {
+		t.Fatalf("expected: %v, got %v", 2, exported)
+	}
+}
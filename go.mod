@@ -1,4 +1,4 @@
 // Deprecated: this library is no longer maintained. Please use other libraries or the standard library.
 module github.com/bxcodec/gotcha
 
-go 1.19
+go 1.23
@@ -1,13 +1,20 @@
 package gotcha
 
 import (
+	"context"
+	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bxcodec/gotcha/cache"
 	"github.com/bxcodec/gotcha/internal"
+	"github.com/bxcodec/gotcha/internal/arena"
+	"github.com/bxcodec/gotcha/internal/disk"
 	"github.com/bxcodec/gotcha/internal/lfu"
 	"github.com/bxcodec/gotcha/internal/lru"
+	"github.com/bxcodec/gotcha/internal/radix"
 )
 
 var (
@@ -15,7 +22,8 @@ var (
 	DefaultCache = New()
 )
 
-// New will create a new cache client. If the options not set, the cache will use the default options
+// New will create a new cache client. If the options not set, the cache will use the default options.
+// It panics if the encryption keys are invalid
 func New(options ...*cache.Option) (c cache.Cache) {
 	option := mergeOptions(options...)
 	if option.MaxSizeItem == 0 {
@@ -31,10 +39,51 @@ func New(options ...*cache.Option) (c cache.Cache) {
 		option.ExpiryTime = cache.DefaultExpiryTime
 	}
 
-	c = &Cache{
-		repo:  NewRepository(*option),
-		mutex: &sync.RWMutex{},
+	if option.AOFRewriteSize == 0 {
+		option.AOFRewriteSize = cache.DefaultAOFRewriteSize
 	}
+
+	if option.Compressor != nil && option.CompressionThreshold == nil {
+		threshold := uint64(cache.DefaultCompressionThreshold)
+		option.CompressionThreshold = &threshold
+	}
+
+	if option.DiskTierSegmentSize == 0 {
+		option.DiskTierSegmentSize = cache.DefaultDiskTierSegmentSize
+	}
+
+	if option.SnapshotCodec == nil {
+		option.SnapshotCodec = GobSnapshotCodec{}
+	}
+
+	if len(option.EncryptionKeys) != 0 {
+		option.SnapshotCodec = sealedSnapshotCodec{codec: option.SnapshotCodec, keys: mustKeyring(option.EncryptionKeys)}
+	}
+
+	if option.RandSource == nil {
+		option.RandSource = rand.NewSource(time.Now().UnixNano())
+	}
+
+	client := &Cache{
+		repo:       NewRepository(*option),
+		mutex:      &sync.RWMutex{},
+		option:     *option,
+		rand:       rand.New(option.RandSource), //nolint:gosec
+		randMutex:  &sync.Mutex{},
+		tags:       tagIndex{},
+		spilled:    map[string]*cache.Document{},
+		namespaces: map[string]*namespace{},
+		stop:       make(chan struct{}),
+	}
+	client.repo.SetRemovalListener(client.onRemove)
+	client.startDiskTier()
+	if option.AOFPath != "" {
+		client.startAOF()
+	} else {
+		client.loadSnapshot()
+	}
+	client.startSnapshot()
+	c = client
 	return
 }
 
@@ -58,6 +107,81 @@ func mergeOptions(options ...*cache.Option) (opts *cache.Option) {
 		if op.MaxSizeItem != 0 {
 			opts.MaxSizeItem = op.MaxSizeItem
 		}
+		if op.ExpiryJitter != 0 {
+			opts.ExpiryJitter = op.ExpiryJitter
+		}
+		if op.JitterRange != 0 {
+			opts.JitterRange = op.JitterRange
+		}
+		if op.ResetFrequency {
+			opts.ResetFrequency = op.ResetFrequency
+		}
+		if op.KeyIndex {
+			opts.KeyIndex = op.KeyIndex
+		}
+		if op.IterationMode != cache.SnapshotIteration {
+			opts.IterationMode = op.IterationMode
+		}
+		if op.XFetchBeta != 0 {
+			opts.XFetchBeta = op.XFetchBeta
+		}
+		if op.RandSource != nil {
+			opts.RandSource = op.RandSource
+		}
+		if op.SnapshotCodec != nil {
+			opts.SnapshotCodec = op.SnapshotCodec
+		}
+		if op.SnapshotPath != "" {
+			opts.SnapshotPath = op.SnapshotPath
+		}
+		if op.SnapshotInterval != 0 {
+			opts.SnapshotInterval = op.SnapshotInterval
+		}
+		if op.OnSnapshotError != nil {
+			opts.OnSnapshotError = op.OnSnapshotError
+		}
+		if op.AOFPath != "" {
+			opts.AOFPath = op.AOFPath
+		}
+		if op.AOFSync != cache.AOFSyncEverySecond {
+			opts.AOFSync = op.AOFSync
+		}
+		if op.AOFRewriteSize != 0 {
+			opts.AOFRewriteSize = op.AOFRewriteSize
+		}
+		if op.OnAOFError != nil {
+			opts.OnAOFError = op.OnAOFError
+		}
+		if op.DiskTierPath != "" {
+			opts.DiskTierPath = op.DiskTierPath
+		}
+		if op.DiskTierSegmentSize != 0 {
+			opts.DiskTierSegmentSize = op.DiskTierSegmentSize
+		}
+		if op.DiskTierMaxSize != 0 {
+			opts.DiskTierMaxSize = op.DiskTierMaxSize
+		}
+		if op.OnDiskTierError != nil {
+			opts.OnDiskTierError = op.OnDiskTierError
+		}
+		if op.Codec != nil {
+			opts.Codec = op.Codec
+		}
+		if op.Compressor != nil {
+			opts.Compressor = op.Compressor
+		}
+		if op.CompressionThreshold != nil {
+			opts.CompressionThreshold = op.CompressionThreshold
+		}
+		if len(op.EncryptionKeys) != 0 {
+			opts.EncryptionKeys = op.EncryptionKeys
+		}
+		if op.Isolation != cache.NoIsolation {
+			opts.Isolation = op.Isolation
+		}
+		if op.Cloner != nil {
+			opts.Cloner = op.Cloner
+		}
 	}
 	return
 }
@@ -72,11 +196,31 @@ func Get(key string) (value interface{}, err error) {
 	return DefaultCache.Get(key)
 }
 
+// GetOrLoad will get an item from cache or load it with the loader using default option
+func GetOrLoad(ctx context.Context, key string, loader cache.LoaderFunc) (value interface{}, err error) {
+	return DefaultCache.GetOrLoad(ctx, key, loader)
+}
+
 // Delete will delete an item from the cache using default option
 func Delete(key string) (err error) {
 	return DefaultCache.Delete(key)
 }
 
+// GetMany will get the items from cache using default option
+func GetMany(keys []string) (values map[string]interface{}, missing []string) {
+	return DefaultCache.GetMany(keys)
+}
+
+// SetMany will set the items to cache using default option
+func SetMany(items map[string]interface{}) (err error) {
+	return DefaultCache.SetMany(items)
+}
+
+// DeleteMany will delete the items from cache using default option
+func DeleteMany(keys []string) (err error) {
+	return DefaultCache.DeleteMany(keys)
+}
+
 // GetKeys will get all keys from the cache using default option
 func GetKeys() (keys []string, err error) {
 	return DefaultCache.GetKeys()
@@ -89,57 +233,186 @@ func ClearCache() (err error) {
 
 // NewRepository return the implementations of repository cache
 func NewRepository(option cache.Option) internal.Repository {
+	var jitter *internal.Jitter
+	if option.ExpiryJitter != 0 || option.JitterRange != 0 {
+		src := rand.NewSource(time.Now().UnixNano())
+		if option.RandSource != nil {
+			// Derive a new source, since a source is not safe to be shared
+			src = rand.NewSource(option.RandSource.Int63())
+		}
+		jitter = internal.NewJitter(option.ExpiryJitter, option.JitterRange, src)
+	}
+
+	var index *radix.Tree
+	if option.KeyIndex {
+		index = radix.New()
+	}
+
+	var transforms []valueTransform
+	if option.Compressor != nil {
+		transforms = append(transforms, compression{compressor: option.Compressor, threshold: *option.CompressionThreshold})
+	}
+	if len(option.EncryptionKeys) != 0 {
+		// Encrypt after compressing, since the encrypted values are not compressible
+		transforms = append(transforms, mustKeyring(option.EncryptionKeys))
+	}
+
+	var memory *internal.Memory
+	switch {
+	case option.MaxMemory == 0:
+	case len(transforms) != 0:
+		// The values are stored encoded
+		memory = internal.NewMemory(storedSizer)
+	case option.Codec != nil:
+		memory = internal.NewMemory(codecSizer(option.Codec))
+	}
+
 	var repo internal.Repository
 	switch option.AlgorithmType {
 	case cache.LRUAlgorithm:
-		repo = lru.New(option.MaxSizeItem, option.MaxMemory, option.ExpiryTime)
+		lruRepo := lru.New(option.MaxSizeItem, option.MaxMemory, option.ExpiryTime)
+		lruRepo.SetJitter(jitter)
+		lruRepo.SetKeyIndex(index)
+		lruRepo.SetMemory(memory)
+		repo = lruRepo
 	case cache.LFUAlgorithm:
-		repo = lfu.New(option.MaxSizeItem, option.MaxMemory, option.ExpiryTime)
+		lfuRepo := lfu.New(option.MaxSizeItem, option.MaxMemory, option.ExpiryTime)
+		lfuRepo.SetJitter(jitter)
+		lfuRepo.SetResetFrequency(option.ResetFrequency)
+		lfuRepo.SetKeyIndex(index)
+		lfuRepo.SetMemory(memory)
+		repo = lfuRepo
+	case cache.ArenaAlgorithm:
+		capacity := option.MaxMemory
+		if capacity == 0 {
+			capacity = cache.DefaultMaxMemory
+		}
+		arenaRepo := arena.New(option.MaxSizeItem, capacity, option.ExpiryTime)
+		arenaRepo.SetJitter(jitter)
+		repo = arenaRepo
+	}
+
+	if len(transforms) != 0 {
+		codec := option.Codec
+		if codec == nil {
+			codec = GobCodec{}
+		}
+		repo = &encodedRepository{Repository: repo, codec: codec, transforms: transforms}
+	} else if option.Isolation != cache.NoIsolation {
+		cloner := option.Cloner
+		if cloner == nil {
+			cloner = CodecCloner{Codec: option.Codec}
+		}
+		repo = &isolatedRepository{Repository: repo, cloner: cloner, mode: option.Isolation}
 	}
 	return repo
 }
 
 // Cache represent the Cache handler
 type Cache struct {
-	mutex *sync.RWMutex
-	repo  internal.Repository
+	version    uint64 // the last version of the documents, keep it first for the 64-bit alignment
+	mutex      *sync.RWMutex
+	repo       internal.Repository
+	option     cache.Option
+	rand       *rand.Rand
+	randMutex  *sync.Mutex
+	tags       tagIndex
+	namespaces map[string]*namespace
+
+	aof        *appendOnlyFile            // nil if the append only file is disabled
+	disk       *disk.Store                // nil if the disk tier is disabled
+	spilled    map[string]*cache.Document // metadata of the spilled documents with tags, to remove their tags
+	stop       chan struct{}              // closed by Close to stop the background goroutines
+	background sync.WaitGroup
+	closeOnce  sync.Once
 }
 
 // Set used for setting the item to cache
 // TODO: (bxcodec)
 // Add Test for this function
 func (c *Cache) Set(key string, value interface{}) (err error) {
-	document := &cache.Document{
+	document := c.newDocument(key, value)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err = c.store(document)
+	return
+}
+
+// newDocument return the document with a new version, so every write has a unique version
+func (c *Cache) newDocument(key string, value interface{}) *cache.Document {
+	return &cache.Document{
 		Key:        key,
 		Value:      value,
 		StoredTime: time.Now().Unix(),
+		Version:    atomic.AddUint64(&c.version, 1),
 	}
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	err = c.repo.Set(document)
-	return
 }
 
 // Get will retrieve the item from cache
 // TODO: (bxcodec)
 // Add Test for this function
 func (c *Cache) Get(key string) (value interface{}, err error) {
-	c.mutex.RLock()
-	doc, err := c.repo.Get(key)
-	c.mutex.RUnlock()
+	// Write lock, since retrieving the item will update the recent-ness or the frequency
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.get(key)
 	if err != nil {
 		return
 	}
+	if c.isEarlyExpired(doc) {
+		return nil, cache.ErrMissed
+	}
 	value = doc.Value
 	return
 }
 
+// GetOrLoad will retrieve the item from cache, or load it with the loader
+// and store it to the cache when the item is missing or early expired
+func (c *Cache) GetOrLoad(ctx context.Context, key string, loader cache.LoaderFunc) (value interface{}, err error) {
+	value, err = c.Get(key)
+	if err != cache.ErrMissed {
+		return
+	}
+
+	start := time.Now()
+	value, err = loader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	document := c.newDocument(key, value)
+	document.Delta = time.Since(start)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err = c.store(document); err != nil {
+		return
+	}
+	return c.isolateStored(value)
+}
+
+// isEarlyExpired implements the XFetch algorithm from the paper "Optimal Probabilistic
+// Cache Stampede Prevention" (Vattani, Chierichetti, Lowenstein). An item is treated as expired
+// when now - delta * beta * log(rand()) >= expiry, so the more expensive the recomputation,
+// the earlier a single caller will refresh it before the real expiry.
+// It must be called with the lock held, since the document is shared with the repository.
+func (c *Cache) isEarlyExpired(doc *cache.Document) bool {
+	if c.option.XFetchBeta <= 0 || doc.Delta <= 0 || doc.TTL == cache.NoExpiration {
+		return false
+	}
+
+	c.randMutex.Lock()
+	rnd := 1 - c.rand.Float64() // (0, 1] to avoid log(0)
+	c.randMutex.Unlock()
+
+	gap := time.Duration(float64(doc.Delta) * c.option.XFetchBeta * -math.Log(rnd))
+	return !time.Now().Add(gap).Before(doc.ExpiresAt())
+}
+
 // Delete will remove the item from cache
 // TODO: (bxcodec)
 // Add Test for this function
 func (c *Cache) Delete(key string) (err error) {
 	c.mutex.Lock()
-	_, err = c.repo.Delete(key)
+	_, err = c.remove(key)
 	c.mutex.Unlock()
 	if err != nil {
 		return
@@ -147,12 +420,15 @@ func (c *Cache) Delete(key string) (err error) {
 	return
 }
 
-// GetKeys will retrieve all keys from cache
+// GetKeys will retrieve all keys from cache, including the keys in the disk tier
 // TODO: (bxcodec)
 // Add Test for this function
 func (c *Cache) GetKeys() (keys []string, err error) {
 	c.mutex.RLock()
 	keys, err = c.repo.Keys()
+	if err == nil && c.disk != nil {
+		keys = append(keys, c.disk.KeysWithPrefix("")...)
+	}
 	c.mutex.RUnlock()
 	return keys, err
 }
@@ -162,7 +438,195 @@ func (c *Cache) GetKeys() (keys []string, err error) {
 // Add Test for this function
 func (c *Cache) ClearCache() (err error) {
 	c.mutex.Lock()
-	err = c.repo.Clear()
+	err = c.clear()
+	if err == nil {
+		err = c.logClear()
+	}
 	c.mutex.Unlock()
 	return
 }
+
+// clear removes all the items from the memory and the disk tier. The caller must hold the lock
+func (c *Cache) clear() (err error) {
+	err = c.repo.Clear()
+	c.tags = tagIndex{}
+	c.spilled = map[string]*cache.Document{}
+	if err == nil && c.disk != nil {
+		err = c.disk.Clear()
+	}
+	return
+}
+
+// ExpiryStats will return the distribution of the remaining time to live of the stored items,
+// including the items in the disk tier
+func (c *Cache) ExpiryStats() (stats cache.ExpiryStats, err error) {
+	var ttls []time.Duration
+	noExpiry := 0
+	now := time.Now()
+	collect := func(expiry time.Time) {
+		if expiry.IsZero() {
+			noExpiry++
+			return
+		}
+		ttls = append(ttls, expiry.Sub(now))
+	}
+	c.mutex.RLock()
+	c.repo.RangeMetadata(func(doc *cache.Document) bool {
+		collect(doc.ExpiresAt())
+		return true
+	})
+	if c.disk != nil {
+		c.disk.Range(func(_ string, expiry time.Time) bool {
+			collect(expiry)
+			return true
+		})
+	}
+	c.mutex.RUnlock()
+
+	stats = newExpiryStats(ttls)
+	stats.NoExpiry = noExpiry
+	return
+}
+
+// expiryStatsBuckets is the number of buckets of the expiry stats histogram
+const expiryStatsBuckets = 10
+
+func newExpiryStats(ttls []time.Duration) (stats cache.ExpiryStats) {
+	if len(ttls) == 0 {
+		return
+	}
+
+	stats.Count = len(ttls)
+	stats.Min, stats.Max = ttls[0], ttls[0]
+	var total time.Duration
+	for _, ttl := range ttls {
+		if ttl < stats.Min {
+			stats.Min = ttl
+		}
+		if ttl > stats.Max {
+			stats.Max = ttl
+		}
+		total += ttl
+	}
+	stats.Mean = total / time.Duration(len(ttls))
+
+	width := (stats.Max-stats.Min)/expiryStatsBuckets + 1
+	stats.Histogram = make([]cache.ExpiryBucket, expiryStatsBuckets)
+	for i := range stats.Histogram {
+		stats.Histogram[i].Start = stats.Min + width*time.Duration(i)
+		stats.Histogram[i].End = stats.Histogram[i].Start + width
+	}
+	for _, ttl := range ttls {
+		stats.Histogram[(ttl-stats.Min)/width].Count++
+	}
+	return
+}
+
+// TTL will return the remaining time to live of the item,
+// or cache.NoExpiration if the item will never be expired
+func (c *Cache) TTL(key string) (ttl time.Duration, err error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	doc, err := c.peekMetadata(key)
+	if err != nil {
+		return
+	}
+	if doc.TTL == cache.NoExpiration {
+		return cache.NoExpiration, nil
+	}
+	ttl = time.Until(doc.ExpiresAt())
+	return
+}
+
+// Touch will extend the time to live of the item starting from now, without updating
+// the recent-ness or the frequency of the item. Zero ttl will use the default expiry time
+func (c *Cache) Touch(key string, ttl time.Duration) (err error) {
+	if ttl == 0 {
+		ttl = c.option.ExpiryTime
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.peekMetadata(key)
+	if err != nil {
+		return
+	}
+	return c.setTTL(doc, time.Now().Unix(), ttl)
+}
+
+// ExpireAt will set the item to be expired at the given time. If the time already passed,
+// the item will be removed from the cache
+func (c *Cache) ExpireAt(key string, expiry time.Time) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.peekMetadata(key)
+	if err != nil {
+		return
+	}
+	if !expiry.After(time.Now()) {
+		_, err = c.remove(key)
+		return
+	}
+	return c.setTTL(doc, doc.StoredTime, expiry.Sub(time.Unix(doc.StoredTime, 0)))
+}
+
+// Persist will remove the expiry time of the item, so it will never be expired
+func (c *Cache) Persist(key string) (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.peekMetadata(key)
+	if err != nil {
+		return
+	}
+	return c.setTTL(doc, doc.StoredTime, cache.NoExpiration)
+}
+
+// setTTL will change the expiry time of the document in the repository, since the repository
+// may return a copy of the document. The caller must hold the lock
+func (c *Cache) setTTL(doc *cache.Document, storedTime int64, ttl time.Duration) (err error) {
+	err = c.repo.SetTTL(doc.Key, storedTime, ttl)
+	if err == cache.ErrMissed {
+		// The document is in the disk tier
+		if _, err = c.promote(doc.Key); err == nil {
+			err = c.repo.SetTTL(doc.Key, storedTime, ttl)
+		}
+	}
+	if err != nil {
+		return
+	}
+	updated := *doc
+	updated.StoredTime = storedTime
+	updated.TTL = ttl
+	return c.logExpire(&updated)
+}
+
+// peek will retrieve the non-expired item without updating the recent-ness or the frequency.
+// The caller must hold the lock
+func (c *Cache) peek(key string) (doc *cache.Document, err error) {
+	doc, err = c.repo.Peek(key)
+	if err == cache.ErrMissed {
+		doc, err = c.peekSpilled(key)
+	}
+	if err != nil {
+		return
+	}
+	if doc.IsExpired() {
+		return nil, cache.ErrMissed
+	}
+	return
+}
+
+// peekMetadata is peek without decoding or copying the value, for checking the existence,
+// the expiry time or the version of the item. The caller must hold the lock
+func (c *Cache) peekMetadata(key string) (doc *cache.Document, err error) {
+	doc, err = c.repo.PeekMetadata(key)
+	if err == cache.ErrMissed {
+		doc, err = c.peekSpilled(key)
+	}
+	if err != nil {
+		return
+	}
+	if doc.IsExpired() {
+		return nil, cache.ErrMissed
+	}
+	return
+}
@@ -1,9 +1,16 @@
 package gotcha_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
 )
 
 func TestGotcha(t *testing.T) {
@@ -102,3 +109,317 @@ func TestGotcha(t *testing.T) {
 		}
 	})
 }
+
+func TestGetOrLoad(t *testing.T) {
+	c := gotcha.New()
+	counter := 0
+	loader := func(ctx context.Context, key string) (interface{}, error) {
+		counter++
+		return "John Snow", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		val, err := c.GetOrLoad(context.Background(), "name", loader)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val.(string) != "John Snow" {
+			t.Fatalf("expected: %v, got %v", "John Snow", val)
+		}
+	}
+	if counter != 1 {
+		t.Fatalf("expected: %v, got %v", 1, counter)
+	}
+
+	errLoader := errors.New("loader error")
+	_, err := c.GetOrLoad(context.Background(), "kingdom", func(ctx context.Context, key string) (interface{}, error) {
+		return nil, errLoader
+	})
+	if err != errLoader {
+		t.Fatalf("expected: %v, got %v", errLoader, err)
+	}
+	_, err = c.Get("kingdom")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestGetOrLoadXFetch(t *testing.T) {
+	loader := func(counter *int) cache.LoaderFunc {
+		return func(ctx context.Context, key string) (interface{}, error) {
+			*counter++
+			time.Sleep(time.Millisecond * 10)
+			return "John Snow", nil
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute))
+		counter := 0
+		for i := 0; i < 5; i++ {
+			_, err := c.GetOrLoad(context.Background(), "name", loader(&counter))
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		if counter != 1 {
+			t.Fatalf("expected: %v, got %v", 1, counter)
+		}
+	})
+
+	t.Run("early-expired", func(t *testing.T) {
+		// With a huge beta, the 10ms recompute time is spread far beyond the expiry time,
+		// so every read is treated as expired early
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute).
+			SetXFetchBeta(1e6).SetRandSource(rand.NewSource(1)))
+		counter := 0
+		for i := 0; i < 5; i++ {
+			_, err := c.GetOrLoad(context.Background(), "name", loader(&counter))
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		if counter != 5 {
+			t.Fatalf("expected: %v, got %v", 5, counter)
+		}
+	})
+
+	t.Run("not-loaded-item", func(t *testing.T) {
+		// Items stored with Set have no recompute time, so they never expire early
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute).
+			SetXFetchBeta(1e6).SetRandSource(rand.NewSource(1)))
+		err := c.Set("name", "John Snow")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Get("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	})
+
+	t.Run("concurrent-touch", func(t *testing.T) {
+		// The early expiry is decided under the lock, while Touch changes the expiry time
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute).SetXFetchBeta(1))
+		counter := 0
+		_, err := c.GetOrLoad(context.Background(), "name", loader(&counter))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_ = c.Touch("name", time.Minute)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, _ = c.Get("name")
+			}
+		}()
+		wg.Wait()
+	})
+}
+
+func TestExpiryJitter(t *testing.T) {
+	setItems := func(c cache.Cache) {
+		for i := 0; i < 1000; i++ {
+			err := c.Set(fmt.Sprintf("key-%d", i), i)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+	}
+
+	t.Run("without-jitter", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute).SetMaxSizeItem(1000))
+		setItems(c)
+		stats, err := c.ExpiryStats()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if stats.Count != 1000 {
+			t.Fatalf("expected: %v, got %v", 1000, stats.Count)
+		}
+		// The stored time is in second, so all items are expired within the same second
+		if stats.Max-stats.Min > time.Second {
+			t.Fatalf("expected: %v, got %v", "less than a second", stats.Max-stats.Min)
+		}
+	})
+
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run("with-jitter-"+algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetExpiryTime(time.Minute).
+				SetMaxSizeItem(1000).SetExpiryJitter(0.5).SetRandSource(rand.NewSource(1)))
+			setItems(c)
+			stats, err := c.ExpiryStats()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if stats.Count != 1000 {
+				t.Fatalf("expected: %v, got %v", 1000, stats.Count)
+			}
+			if stats.Min < 29*time.Second || stats.Max > 90*time.Second {
+				t.Fatalf("expected: %v, got [%v, %v]", "within [30s, 90s]", stats.Min, stats.Max)
+			}
+			if stats.Max-stats.Min < 50*time.Second {
+				t.Fatalf("expected: %v, got %v", "spread over 50s", stats.Max-stats.Min)
+			}
+
+			total := 0
+			for _, bucket := range stats.Histogram {
+				// Uniformly distributed, so no bucket should hold most of the items
+				if bucket.Count > 200 {
+					t.Fatalf("expected: %v, got %v", "less than 200", bucket.Count)
+				}
+				total += bucket.Count
+			}
+			if total != 1000 {
+				t.Fatalf("expected: %v, got %v", 1000, total)
+			}
+		})
+	}
+
+	t.Run("with-jitter-range", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute).
+			SetMaxSizeItem(1000).SetJitterRange(5 * time.Second))
+		setItems(c)
+		stats, err := c.ExpiryStats()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if stats.Min < 54*time.Second || stats.Max > 65*time.Second {
+			t.Fatalf("expected: %v, got [%v, %v]", "within [55s, 65s]", stats.Min, stats.Max)
+		}
+	})
+}
+
+func TestTTL(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetExpiryTime(time.Minute))
+	err := c.Set("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		ttl, err := c.TTL("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl > time.Minute || ttl < time.Minute-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "around a minute", ttl)
+		}
+
+		_, err = c.TTL("kingdom")
+		if err != cache.ErrMissed {
+			t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+		}
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		err := c.Touch("name", time.Hour)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		ttl, err := c.TTL("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl > time.Hour || ttl < time.Hour-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "around an hour", ttl)
+		}
+
+		err = c.Touch("kingdom", time.Hour)
+		if err != cache.ErrMissed {
+			t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+		}
+	})
+
+	t.Run("expire-at", func(t *testing.T) {
+		err := c.ExpireAt("name", time.Now().Add(time.Hour*2))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		ttl, err := c.TTL("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl > time.Hour*2 || ttl < time.Hour*2-time.Second*2 {
+			t.Fatalf("expected: %v, got %v", "around two hours", ttl)
+		}
+	})
+
+	t.Run("persist", func(t *testing.T) {
+		err := c.Persist("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		ttl, err := c.TTL("name")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if ttl != cache.NoExpiration {
+			t.Fatalf("expected: %v, got %v", cache.NoExpiration, ttl)
+		}
+		stats, err := c.ExpiryStats()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if stats.NoExpiry != 1 || stats.Count != 0 {
+			t.Fatalf("expected: %v, got %v", "1 item without expiry", stats)
+		}
+	})
+
+	t.Run("expire-at-past", func(t *testing.T) {
+		err := c.ExpireAt("name", time.Now().Add(-time.Second))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Get("name")
+		if err != cache.ErrMissed {
+			t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+		}
+	})
+}
+
+func TestTouchWithoutUpdatingRecentness(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(3))
+			for _, key := range []string{"key-1", "key-2", "key-3"} {
+				err := c.Set(key, key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			// Read the newer items, so key-1 remains the least recently and frequently used
+			for _, key := range []string{"key-2", "key-3"} {
+				_, err := c.Get(key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+
+			err := c.Touch("key-1", time.Hour)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			_, err = c.TTL("key-1")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			err = c.Set("key-4", "key-4")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			_, err = c.Get("key-1")
+			if err != cache.ErrMissed {
+				t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+			}
+		})
+	}
+}
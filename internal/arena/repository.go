@@ -0,0 +1,446 @@
+package arena
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
+)
+
+// The layout of the entry header, followed by the key, the key ID, the tags and the value
+const (
+	offsetFlags      = 0  // uint8
+	offsetKeyIDLen   = 1  // uint8, length of the encryption key ID
+	offsetLength     = 4  // uint32, total length of the entry including the header
+	offsetStoredTime = 8  // int64
+	offsetTTL        = 16 // int64
+	offsetDelta      = 24 // int64
+	offsetVersion    = 32 // uint64
+	offsetKeyLength  = 40 // uint16
+	offsetTagsLength = 42 // uint32
+	headerSize       = 46
+)
+
+const (
+	flagDeleted  uint8 = 1 << iota // the entry is deleted or replaced, its space is reclaimed when the head passes
+	flagAccessed                   // the entry is accessed since stored, so it gets a second chance on eviction
+)
+
+// MaxKeySize is the maximum size of the key
+const MaxKeySize = 1<<16 - 1
+
+// Repository stores the []byte values in a preallocated ring buffer, indexed by a map
+// of the key hash to the entry offset. Neither of them contains pointers, so the GC doesn't scan the entries.
+// The entries are evicted from the oldest, except the accessed entries that are moved to the newest once,
+// which approximates LRU. A key colliding with the hash of another key replaces the other key
+type Repository struct {
+	buf            []byte
+	head           uint64 // offset of the oldest entry
+	tail           uint64 // offset of the next entry
+	used           uint64 // bytes used by the entries between head and tail
+	index          map[uint64]uint32
+	count          uint64
+	maxSize        uint64
+	expiryTreshold time.Duration
+	jitter         *internal.Jitter
+	onRemove       func(doc *cache.Document)
+	onEvict        func(doc *cache.Document)
+}
+
+// New will initialize the arena with the given capacity in bytes, up to 4GB
+func New(maxSize, capacity uint64, expiryTreshold time.Duration) *Repository {
+	if capacity > 1<<32-1 {
+		capacity = 1<<32 - 1
+	}
+	return &Repository{
+		buf:            make([]byte, capacity),
+		index:          make(map[uint64]uint32),
+		maxSize:        maxSize,
+		expiryTreshold: expiryTreshold,
+	}
+}
+
+// SetJitter will randomize the expiry time of the items stored afterwards
+func (r *Repository) SetJitter(jitter *internal.Jitter) {
+	r.jitter = jitter
+}
+
+// SetRemovalListener will call fn with the document removed from the cache, either deleted, evicted,
+// expired or replaced by the new document with the same key. It's not called by Clear
+func (r *Repository) SetRemovalListener(fn func(doc *cache.Document)) {
+	r.onRemove = fn
+}
+
+// SetEvictionListener will call fn with the document evicted because the max size or the capacity reached,
+// after the removal listener
+func (r *Repository) SetEvictionListener(fn func(doc *cache.Document)) {
+	r.onEvict = fn
+}
+
+// hash is FNV-1a, inlined to avoid the allocation of hash/fnv
+func hash(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// write copies the data to the buffer from the offset, wrapping around the end of the buffer
+func (r *Repository) write(offset uint64, data []byte) {
+	n := copy(r.buf[offset:], data)
+	copy(r.buf, data[n:])
+}
+
+// read copies the n bytes of the buffer from the offset, wrapping around the end of the buffer
+func (r *Repository) read(offset, n uint64, dst []byte) []byte {
+	dst = dst[:n]
+	m := copy(dst, r.buf[offset:])
+	copy(dst[m:], r.buf)
+	return dst
+}
+
+func (r *Repository) wrap(offset uint64) uint64 {
+	return offset % uint64(len(r.buf))
+}
+
+func (r *Repository) header(offset uint64) []byte {
+	return r.read(offset, headerSize, make([]byte, headerSize))
+}
+
+// setFlags updates the flags in the header of the entry
+func (r *Repository) setFlags(offset uint64, flags uint8) {
+	r.buf[r.wrap(offset+offsetFlags)] = flags
+}
+
+// lookup returns the offset and the header of the entry of the key
+func (r *Repository) lookup(key string) (offset uint64, header []byte, ok bool) {
+	off, ok := r.index[hash(key)]
+	if !ok {
+		return
+	}
+	offset = uint64(off)
+	header = r.header(offset)
+	keyLen := uint64(binary.BigEndian.Uint16(header[offsetKeyLength:]))
+	if keyLen != uint64(len(key)) || string(r.read(r.wrap(offset+headerSize), keyLen, make([]byte, keyLen))) != key {
+		return 0, nil, false
+	}
+	return offset, header, true
+}
+
+// document decodes the entry, the value is copied so it's safe to be used after the entry is overwritten
+func (r *Repository) document(offset uint64, header []byte) *cache.Document {
+	doc := r.metadata(offset, header)
+	length := uint64(binary.BigEndian.Uint32(header[offsetLength:]))
+	valueOffset := headerSize + uint64(len(doc.Key)) + uint64(len(doc.KeyID)) +
+		uint64(binary.BigEndian.Uint32(header[offsetTagsLength:]))
+	doc.Value = r.read(r.wrap(offset+valueOffset), length-valueOffset, make([]byte, length-valueOffset))
+	return doc
+}
+
+// metadata decodes the entry without the value
+func (r *Repository) metadata(offset uint64, header []byte) *cache.Document {
+	keyLen := uint64(binary.BigEndian.Uint16(header[offsetKeyLength:]))
+	idLen := uint64(header[offsetKeyIDLen])
+	tagsLen := uint64(binary.BigEndian.Uint32(header[offsetTagsLength:]))
+	entry := r.read(r.wrap(offset+headerSize), keyLen+idLen+tagsLen, make([]byte, keyLen+idLen+tagsLen))
+
+	doc := &cache.Document{
+		Key:        string(entry[:keyLen]),
+		KeyID:      string(entry[keyLen : keyLen+idLen]),
+		StoredTime: int64(binary.BigEndian.Uint64(header[offsetStoredTime:])),
+		TTL:        time.Duration(binary.BigEndian.Uint64(header[offsetTTL:])),
+		Delta:      time.Duration(binary.BigEndian.Uint64(header[offsetDelta:])),
+		Version:    binary.BigEndian.Uint64(header[offsetVersion:]),
+	}
+	tags := entry[keyLen+idLen:]
+	for len(tags) > 0 {
+		n, size := binary.Uvarint(tags)
+		doc.Tags = append(doc.Tags, string(tags[size:size+int(n)]))
+		tags = tags[size+int(n):]
+	}
+	return doc
+}
+
+// encode returns the entry of the document
+func encode(doc *cache.Document, value []byte) []byte {
+	var tags []byte
+	for _, tag := range doc.Tags {
+		tags = binary.AppendUvarint(tags, uint64(len(tag)))
+		tags = append(tags, tag...)
+	}
+
+	length := headerSize + len(doc.Key) + len(doc.KeyID) + len(tags) + len(value)
+	entry := make([]byte, headerSize, length)
+	entry[offsetKeyIDLen] = uint8(len(doc.KeyID))
+	binary.BigEndian.PutUint32(entry[offsetLength:], uint32(length))
+	binary.BigEndian.PutUint64(entry[offsetStoredTime:], uint64(doc.StoredTime))
+	binary.BigEndian.PutUint64(entry[offsetTTL:], uint64(doc.TTL))
+	binary.BigEndian.PutUint64(entry[offsetDelta:], uint64(doc.Delta))
+	binary.BigEndian.PutUint64(entry[offsetVersion:], doc.Version)
+	binary.BigEndian.PutUint16(entry[offsetKeyLength:], uint16(len(doc.Key)))
+	binary.BigEndian.PutUint32(entry[offsetTagsLength:], uint32(len(tags)))
+	entry = append(entry, doc.Key...)
+	entry = append(entry, doc.KeyID...)
+	entry = append(entry, tags...)
+	return append(entry, value...)
+}
+
+// Set will save the []byte value to the arena, it returns cache.ErrUnsupportedValue for the other values
+// and cache.ErrTooLarge if the item is bigger than the capacity
+func (r *Repository) Set(doc *cache.Document) (err error) {
+	value, ok := doc.Value.([]byte)
+	if !ok {
+		return cache.ErrUnsupportedValue
+	}
+	if len(doc.Key) > MaxKeySize {
+		return cache.ErrTooLarge
+	}
+	if doc.TTL == 0 {
+		doc.TTL = r.jitter.Apply(r.expiryTreshold)
+	}
+	entry := encode(doc, value)
+	if uint64(len(entry)) > uint64(len(r.buf)) {
+		return cache.ErrTooLarge
+	}
+
+	// Unlink the existing entry first, so it's not moved while making the room
+	var replaced *cache.Document
+	h := hash(doc.Key)
+	if off, ok := r.index[h]; ok {
+		replaced = r.unlink(uint64(off), h)
+	}
+
+	for uint64(len(r.buf))-r.used < uint64(len(entry)) {
+		r.evictHead()
+	}
+	for r.count >= r.maxSize {
+		r.evictOne()
+	}
+
+	r.write(r.tail, entry)
+	r.index[h] = uint32(r.tail)
+	r.tail = r.wrap(r.tail + uint64(len(entry)))
+	r.used += uint64(len(entry))
+	r.count++
+
+	if replaced != nil && r.onRemove != nil {
+		r.onRemove(replaced)
+	}
+	return
+}
+
+// unlink marks the entry as deleted and removes it from the index, and returns its document
+// if the removal listener is set
+func (r *Repository) unlink(offset, h uint64) (doc *cache.Document) {
+	header := r.header(offset)
+	if r.onRemove != nil {
+		doc = r.document(offset, header)
+	}
+	r.setFlags(offset, header[offsetFlags]|flagDeleted)
+	delete(r.index, h)
+	r.count--
+	return
+}
+
+// evictOne evicts the entries from the head until a live entry is evicted
+func (r *Repository) evictOne() {
+	count := r.count
+	for r.count == count && r.used > 0 {
+		r.evictHead()
+	}
+}
+
+// evictHead reclaims the space of the oldest entry. The accessed entry is moved to the tail
+// with the accessed flag cleared, instead of evicted
+func (r *Repository) evictHead() {
+	offset := r.head
+	header := r.header(offset)
+	length := uint64(binary.BigEndian.Uint32(header[offsetLength:]))
+	flags := header[offsetFlags]
+	r.head = r.wrap(r.head + length)
+	r.used -= length
+	if flags&flagDeleted != 0 {
+		return
+	}
+
+	if flags&flagAccessed != 0 {
+		entry := r.read(offset, length, make([]byte, length))
+		entry[offsetFlags] = flags &^ flagAccessed
+		keyLen := uint64(binary.BigEndian.Uint16(header[offsetKeyLength:]))
+		h := hash(string(entry[headerSize : headerSize+keyLen]))
+		r.write(r.tail, entry)
+		r.index[h] = uint32(r.tail)
+		r.tail = r.wrap(r.tail + length)
+		r.used += length
+		return
+	}
+
+	doc := r.document(offset, header)
+	delete(r.index, hash(doc.Key))
+	r.count--
+	if r.onRemove != nil {
+		r.onRemove(doc)
+	}
+	if r.onEvict != nil {
+		r.onEvict(doc)
+	}
+}
+
+// Get will retrieve the item from the arena, and mark it as accessed
+func (r *Repository) Get(key string) (res *cache.Document, err error) {
+	offset, header, ok := r.lookup(key)
+	if !ok {
+		return nil, cache.ErrMissed
+	}
+	res = r.document(offset, header)
+	if res.IsExpired() {
+		_, _ = r.Delete(key)
+		return nil, cache.ErrMissed
+	}
+	r.setFlags(offset, header[offsetFlags]|flagAccessed)
+	return
+}
+
+// Peek will retrieve the item from the arena without marking it as accessed
+func (r *Repository) Peek(key string) (res *cache.Document, err error) {
+	offset, header, ok := r.lookup(key)
+	if !ok {
+		return nil, cache.ErrMissed
+	}
+	return r.document(offset, header), nil
+}
+
+// PeekMetadata will retrieve the item from the arena without its value and without marking it as accessed
+func (r *Repository) PeekMetadata(key string) (res *cache.Document, err error) {
+	offset, header, ok := r.lookup(key)
+	if !ok {
+		return nil, cache.ErrMissed
+	}
+	return r.metadata(offset, header), nil
+}
+
+// SetTTL will change the expiry time of the item in place without marking it as accessed
+func (r *Repository) SetTTL(key string, storedTime int64, ttl time.Duration) (err error) {
+	offset, _, ok := r.lookup(key)
+	if !ok {
+		return cache.ErrMissed
+	}
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(storedTime))
+	binary.BigEndian.PutUint64(buf[8:], uint64(ttl))
+	r.write(r.wrap(offset+offsetStoredTime), buf[:])
+	return
+}
+
+// SetWithFrequency will save the item to the arena, the frequency is ignored since the arena doesn't track it
+func (r *Repository) SetWithFrequency(doc *cache.Document, frequency uint64) (err error) {
+	return r.Set(doc)
+}
+
+// Frequency always return zero, since the arena doesn't track the frequency of the items
+func (r *Repository) Frequency(key string) (frequency uint64) {
+	return 0
+}
+
+// Contains check if any item with the given key exist in the arena
+func (r *Repository) Contains(key string) (ok bool) {
+	_, _, ok = r.lookup(key)
+	return
+}
+
+// Delete will delete the item from the arena, its space is reclaimed when it's the oldest entry
+func (r *Repository) Delete(key string) (ok bool, err error) {
+	offset, _, ok := r.lookup(key)
+	if !ok {
+		return
+	}
+	doc := r.unlink(offset, hash(key))
+	if r.onRemove != nil {
+		r.onRemove(doc)
+	}
+	return
+}
+
+// Clear will clear up the items from the arena
+func (r *Repository) Clear() (err error) {
+	r.index = make(map[uint64]uint32)
+	r.head, r.tail, r.used, r.count = 0, 0, 0, 0
+	return
+}
+
+// Len return the total items in the arena
+func (r *Repository) Len() int {
+	return int(r.count)
+}
+
+// Range calls fn for each document in the arena, from the oldest until fn returns false
+func (r *Repository) Range(fn func(doc *cache.Document) bool) {
+	r.walk(func(offset uint64, header []byte) bool {
+		return fn(r.document(offset, header))
+	})
+}
+
+// RangeMetadata calls fn for each document in the arena without its value, from the oldest until fn returns false
+func (r *Repository) RangeMetadata(fn func(doc *cache.Document) bool) {
+	r.walk(func(offset uint64, header []byte) bool {
+		return fn(r.metadata(offset, header))
+	})
+}
+
+// walk calls fn with the offset and the header of each item that isn't deleted, from the oldest
+func (r *Repository) walk(fn func(offset uint64, header []byte) bool) {
+	for offset, scanned := r.head, uint64(0); scanned < r.used; {
+		header := r.header(offset)
+		length := uint64(binary.BigEndian.Uint32(header[offsetLength:]))
+		if header[offsetFlags]&flagDeleted == 0 {
+			if !fn(offset, header) {
+				return
+			}
+		}
+		offset = r.wrap(offset + length)
+		scanned += length
+	}
+}
+
+// Keys return all keys from the arena, from the oldest
+func (r *Repository) Keys() (keys []string, err error) {
+	keys = make([]string, 0, r.count)
+	r.RangeMetadata(func(doc *cache.Document) bool {
+		keys = append(keys, doc.Key)
+		return true
+	})
+	return
+}
+
+// KeysWithPrefix return the keys with the given prefix, from the oldest
+func (r *Repository) KeysWithPrefix(prefix string) (keys []string) {
+	r.RangeMetadata(func(doc *cache.Document) bool {
+		if strings.HasPrefix(doc.Key, prefix) {
+			keys = append(keys, doc.Key)
+		}
+		return true
+	})
+	return
+}
+
+// PopOldest removes and returns the oldest item
+func (r *Repository) PopOldest() (res *cache.Document, err error) {
+	r.Range(func(doc *cache.Document) bool {
+		res = doc
+		return false
+	})
+	if res == nil {
+		return nil, cache.ErrMissed
+	}
+	_, err = r.Delete(res.Key)
+	return
+}
+
+// PopLeastFrequent is not supported since the arena doesn't track the frequency of the items
+func (r *Repository) PopLeastFrequent() (res *cache.Document, err error) {
+	return nil, cache.ErrNotSupported
+}
@@ -0,0 +1,318 @@
+package arena_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal/arena"
+)
+
+func newDocument(key string, value []byte) *cache.Document {
+	return &cache.Document{
+		Key:        key,
+		Value:      value,
+		StoredTime: time.Now().Unix(),
+		Tags:       []string{"tag-1", "tag-2"},
+		Version:    1,
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	repo := arena.New(10, 1024, time.Minute)
+	value := []byte("Hello World")
+	err := repo.Set(newDocument("key-1", value))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	// The value is copied to the arena
+	value[0] = 'h'
+	doc, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if string(doc.Value.([]byte)) != "Hello World" {
+		t.Fatalf("expected %v, actual %v", "Hello World", string(doc.Value.([]byte)))
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"tag-1", "tag-2"}) {
+		t.Fatalf("expected %v, actual %v", []string{"tag-1", "tag-2"}, doc.Tags)
+	}
+	if doc.TTL != time.Minute {
+		t.Fatalf("expected %v, actual %v", time.Minute, doc.TTL)
+	}
+
+	_, err = repo.Get("key-2")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+}
+
+func TestSetUnsupported(t *testing.T) {
+	repo := arena.New(10, 1024, time.Minute)
+	err := repo.Set(&cache.Document{Key: "key-1", Value: "Hello World"})
+	if err != cache.ErrUnsupportedValue {
+		t.Fatalf("expected %v, actual %v", cache.ErrUnsupportedValue, err)
+	}
+	err = repo.Set(newDocument("key-1", make([]byte, 1024)))
+	if err != cache.ErrTooLarge {
+		t.Fatalf("expected %v, actual %v", cache.ErrTooLarge, err)
+	}
+	if repo.Len() != 0 {
+		t.Fatalf("expected %v, actual %v", 0, repo.Len())
+	}
+}
+
+func TestEvictByCapacity(t *testing.T) {
+	// Each entry is 46 bytes of header, 5 bytes of key, 12 bytes of tags and 37 bytes of value
+	repo := arena.New(100, 300, time.Minute)
+	var evicted []string
+	repo.SetEvictionListener(func(doc *cache.Document) {
+		evicted = append(evicted, doc.Key)
+	})
+	for i := 1; i <= 5; i++ {
+		err := repo.Set(newDocument(fmt.Sprintf("key-%d", i), make([]byte, 37)))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	if !reflect.DeepEqual(evicted, []string{"key-1", "key-2"}) {
+		t.Fatalf("expected %v, actual %v", []string{"key-1", "key-2"}, evicted)
+	}
+	keys, _ := repo.Keys()
+	if !reflect.DeepEqual(keys, []string{"key-3", "key-4", "key-5"}) {
+		t.Fatalf("expected %v, actual %v", []string{"key-3", "key-4", "key-5"}, keys)
+	}
+}
+
+func TestEvictSecondChance(t *testing.T) {
+	repo := arena.New(100, 300, time.Minute)
+	for i := 1; i <= 3; i++ {
+		err := repo.Set(newDocument(fmt.Sprintf("key-%d", i), make([]byte, 37)))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	// key-1 is accessed, so key-2 is evicted instead and key-1 becomes the newest
+	_, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = repo.Set(newDocument("key-4", make([]byte, 37)))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	keys, _ := repo.Keys()
+	if !reflect.DeepEqual(keys, []string{"key-3", "key-1", "key-4"}) {
+		t.Fatalf("expected %v, actual %v", []string{"key-3", "key-1", "key-4"}, keys)
+	}
+}
+
+func TestEvictByMaxSize(t *testing.T) {
+	repo := arena.New(2, 1024, time.Minute)
+	for i := 1; i <= 3; i++ {
+		err := repo.Set(newDocument(fmt.Sprintf("key-%d", i), []byte("value")))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	if repo.Contains("key-1") {
+		t.Fatalf("expected %v, actual %v", false, true)
+	}
+	if repo.Len() != 2 {
+		t.Fatalf("expected %v, actual %v", 2, repo.Len())
+	}
+}
+
+func TestWrapAround(t *testing.T) {
+	// The entries don't divide the capacity, so they wrap around the end of the buffer
+	repo := arena.New(100, 250, time.Minute)
+	for i := 1; i <= 20; i++ {
+		value := []byte(fmt.Sprintf("value-%02d", i))
+		err := repo.Set(newDocument(fmt.Sprintf("key-%02d", i), value))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+
+		doc, err := repo.Get(fmt.Sprintf("key-%02d", i))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if string(doc.Value.([]byte)) != string(value) {
+			t.Fatalf("expected %v, actual %v", string(value), string(doc.Value.([]byte)))
+		}
+		if !reflect.DeepEqual(doc.Tags, []string{"tag-1", "tag-2"}) {
+			t.Fatalf("expected %v, actual %v", []string{"tag-1", "tag-2"}, doc.Tags)
+		}
+	}
+	keys, _ := repo.Keys()
+	if len(keys) != repo.Len() {
+		t.Fatalf("expected %v, actual %v", repo.Len(), len(keys))
+	}
+}
+
+func TestRemovalListener(t *testing.T) {
+	repo := arena.New(2, 1024, time.Minute)
+	var removed []string
+	repo.SetRemovalListener(func(doc *cache.Document) {
+		removed = append(removed, fmt.Sprintf("%s=%s", doc.Key, doc.Value))
+	})
+	for _, key := range []string{"key-1", "key-2"} {
+		err := repo.Set(newDocument(key, []byte("old")))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	// Replaced, then deleted, then key-1 is evicted by the max size
+	err := repo.Set(newDocument("key-2", []byte("new")))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	ok, err := repo.Delete("key-2")
+	if err != nil || !ok {
+		t.Fatalf("expected %v, actual %v", true, ok)
+	}
+	for _, key := range []string{"key-3", "key-4"} {
+		err = repo.Set(newDocument(key, []byte("old")))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	expected := []string{"key-2=old", "key-2=new", "key-1=old"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Fatalf("expected %v, actual %v", expected, removed)
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	repo := arena.New(10, 1024, time.Second*15)
+	doc := newDocument("key-1", []byte("value"))
+	doc.StoredTime = time.Now().Add(time.Second * -30).Unix()
+	err := repo.Set(doc)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	_, err = repo.Get("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+	if repo.Contains("key-1") {
+		t.Fatalf("expected %v, actual %v", false, true)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	repo := arena.New(10, 1024, time.Second*15)
+	doc := newDocument("key-1", []byte("value"))
+	doc.StoredTime = time.Now().Add(time.Second * -30).Unix()
+	err := repo.Set(doc)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = repo.SetTTL("key-1", time.Now().Unix(), time.Minute)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	doc, err = repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if doc.TTL != time.Minute {
+		t.Fatalf("expected %v, actual %v", time.Minute, doc.TTL)
+	}
+}
+
+func TestClear(t *testing.T) {
+	repo := arena.New(10, 1024, time.Minute)
+	for _, key := range []string{"key-1", "key-2"} {
+		err := repo.Set(newDocument(key, []byte("value")))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	err := repo.Clear()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	keys, _ := repo.Keys()
+	if len(keys) != 0 || repo.Len() != 0 {
+		t.Fatalf("expected %v, actual %v", 0, keys)
+	}
+}
+
+func TestPeekMetadata(t *testing.T) {
+	repo := arena.New(10, 1024, time.Minute)
+	err := repo.Set(newDocument("key-1", []byte("value")))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	doc, err := repo.PeekMetadata("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if doc.Key != "key-1" || doc.Version != 1 || doc.Value != nil {
+		t.Fatalf("expected %v, actual %v", "key-1 without value", doc)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"tag-1", "tag-2"}) {
+		t.Fatalf("expected %v, actual %v", []string{"tag-1", "tag-2"}, doc.Tags)
+	}
+	_, err = repo.PeekMetadata("key-2")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	repo := arena.New(10, 1024, time.Minute)
+	doc := newDocument("key-1", []byte("value"))
+	doc.KeyID = "encryption-key-1"
+	err := repo.Set(doc)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	doc, err = repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if doc.KeyID != "encryption-key-1" || string(doc.Value.([]byte)) != "value" {
+		t.Fatalf("expected %v, actual %v", "encryption-key-1=value", doc)
+	}
+	if !reflect.DeepEqual(doc.Tags, []string{"tag-1", "tag-2"}) {
+		t.Fatalf("expected %v, actual %v", []string{"tag-1", "tag-2"}, doc.Tags)
+	}
+}
+
+func TestRangeMetadata(t *testing.T) {
+	repo := arena.New(10, 64*1024, time.Minute)
+	for i := 0; i < 10; i++ {
+		err := repo.Set(newDocument(fmt.Sprintf("key-%d", i), make([]byte, 1024)))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	repo.RangeMetadata(func(doc *cache.Document) bool {
+		if doc.Value != nil {
+			t.Fatalf("expected %v, actual %v", nil, doc.Value)
+		}
+		return true
+	})
+
+	// The key walks don't copy the values, so each of them allocates at least one less per item than Range
+	ranged := testing.AllocsPerRun(10, func() {
+		repo.Range(func(doc *cache.Document) bool {
+			return true
+		})
+	})
+	keys := testing.AllocsPerRun(10, func() {
+		_, _ = repo.Keys()
+		_ = repo.KeysWithPrefix("key-")
+	})
+	if keys/2 > ranged-10 {
+		t.Fatalf("expected %v, actual %v", ranged-10, keys/2)
+	}
+}
@@ -0,0 +1,389 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+const (
+	// headerSize is the size of the checksum, key length and value length before every record
+	headerSize = 4 + 4 + 4
+	// segmentPattern is the name pattern of the segment files in the directory
+	segmentPattern = "segment-*.dat"
+)
+
+// ErrCorrupted is returned when the record read from the segment fails the checksum
+var ErrCorrupted = errors.New("disk: record's corrupted")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Store keeps the values in the append-only segment files, and the position of each key in memory.
+// A segment is removed by Compact once at least half of it is deleted or overwritten, after its live records are
+// moved to the active segment. The expired records are dropped by the compaction and every new segment,
+// and the oldest segments are dropped once the max size is reached.
+// It's not safe for concurrent use, the caller must synchronize the access, Get, KeysWithPrefix and Range
+// don't modify the store
+type Store struct {
+	dir         string
+	segmentSize int64
+	maxSize     int64 // zero means unlimited
+	nextID      int
+	active      *segment
+	segments    map[int]*segment
+	index       map[string]location
+	rotated     bool // a new segment is created since the last sweep of the expired records
+	onRemove    func(key string)
+}
+
+type segment struct {
+	id   int
+	file *os.File
+	size int64               // total bytes written
+	live int64               // bytes of the records still in the index
+	keys map[string]struct{} // keys of the live records
+}
+
+type location struct {
+	segment   *segment
+	offset    int64
+	length    int64 // length of the record including the header
+	expiresAt int64 // unix nano, zero means never
+}
+
+func (l location) isExpired(now int64) bool {
+	return l.expiresAt != 0 && now >= l.expiresAt
+}
+
+// Open creates the store in the directory. The segment files left in the directory are removed,
+// since the store only lives as long as the cache
+func Open(dir string, segmentSize int64) (s *Store, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	if err = removeSegments(dir); err != nil {
+		return
+	}
+	s = &Store{
+		dir:         dir,
+		segmentSize: segmentSize,
+		segments:    map[int]*segment{},
+		index:       map[string]location{},
+	}
+	if err = s.rotate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func removeSegments(dir string) (err error) {
+	files, err := filepath.Glob(filepath.Join(dir, segmentPattern))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if err = os.Remove(file); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetMaxSize will drop the oldest segments once the size of the segment files reaches the max size,
+// the active segment is never dropped
+func (s *Store) SetMaxSize(maxSize int64) {
+	s.maxSize = maxSize
+}
+
+// SetRemovalListener will call fn with the key dropped by the store, either expired or dropped by the max size.
+// It's not called by Delete and Clear
+func (s *Store) SetRemovalListener(fn func(key string)) {
+	s.onRemove = fn
+}
+
+// rotate creates a new active segment
+func (s *Store) rotate() (err error) {
+	s.nextID++
+	name := filepath.Join(s.dir, fmt.Sprintf("segment-%06d.dat", s.nextID))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	s.active = &segment{
+		id:   s.nextID,
+		file: file,
+		keys: map[string]struct{}{},
+	}
+	s.segments[s.nextID] = s.active
+	s.rotated = true
+	return
+}
+
+// Put stores the value of the key that never expires, replacing the existing value
+func (s *Store) Put(key string, value []byte) (err error) {
+	return s.PutWithExpiry(key, value, time.Time{})
+}
+
+// PutWithExpiry stores the value of the key until the expiry time, replacing the existing value.
+// Zero expiry time means never
+func (s *Store) PutWithExpiry(key string, value []byte, expiry time.Time) (err error) {
+	var expiresAt int64
+	if !expiry.IsZero() {
+		expiresAt = expiry.UnixNano()
+	}
+	s.Delete(key)
+	if err = s.write(key, value, expiresAt); err != nil {
+		return
+	}
+	if s.rotated {
+		s.rotated = false
+		s.sweep()
+	}
+	s.shrink()
+	return
+}
+
+// sweep drops the expired records
+func (s *Store) sweep() {
+	now := time.Now().UnixNano()
+	var expired []string
+	for key, loc := range s.index {
+		if loc.isExpired(now) {
+			expired = append(expired, key)
+		}
+	}
+	for _, key := range expired {
+		s.drop(key)
+	}
+}
+
+// shrink drops the oldest segments until the size is under the max size
+func (s *Store) shrink() {
+	for s.maxSize > 0 && s.Size() > s.maxSize {
+		oldest := s.active
+		for _, seg := range s.segments {
+			if seg.id < oldest.id {
+				oldest = seg
+			}
+		}
+		if oldest == s.active {
+			return
+		}
+		for key := range oldest.keys {
+			delete(s.index, key)
+			if s.onRemove != nil {
+				s.onRemove(key)
+			}
+		}
+		_ = s.remove(oldest)
+	}
+}
+
+// drop deletes the key, and calls the removal listener
+func (s *Store) drop(key string) {
+	if s.Delete(key) && s.onRemove != nil {
+		s.onRemove(key)
+	}
+}
+
+func (s *Store) write(key string, value []byte, expiresAt int64) (err error) {
+	length := int64(headerSize + len(key) + len(value))
+	if s.active.size > 0 && s.active.size+length > s.segmentSize {
+		if err = s.rotate(); err != nil {
+			return
+		}
+	}
+
+	record := make([]byte, length)
+	binary.BigEndian.PutUint32(record[4:], uint32(len(key)))
+	binary.BigEndian.PutUint32(record[8:], uint32(len(value)))
+	copy(record[headerSize:], key)
+	copy(record[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(record, crc32.Checksum(record[4:], crcTable))
+
+	seg := s.active
+	if _, err = seg.file.WriteAt(record, seg.size); err != nil {
+		return
+	}
+	s.index[key] = location{segment: seg, offset: seg.size, length: length, expiresAt: expiresAt}
+	seg.keys[key] = struct{}{}
+	seg.size += length
+	seg.live += length
+	return
+}
+
+// Get returns the value of the key, or cache.ErrMissed if the key doesn't exist or is expired
+func (s *Store) Get(key string) (value []byte, err error) {
+	loc, ok := s.index[key]
+	if !ok || loc.isExpired(time.Now().UnixNano()) {
+		return nil, cache.ErrMissed
+	}
+	return s.read(key, loc)
+}
+
+func (s *Store) read(key string, loc location) (value []byte, err error) {
+	record := make([]byte, loc.length)
+	if _, err = loc.segment.file.ReadAt(record, loc.offset); err != nil {
+		return
+	}
+	keyLen := int64(binary.BigEndian.Uint32(record[4:]))
+	if binary.BigEndian.Uint32(record) != crc32.Checksum(record[4:], crcTable) ||
+		string(record[headerSize:headerSize+keyLen]) != key {
+		return nil, ErrCorrupted
+	}
+	return record[headerSize+keyLen:], nil
+}
+
+// Delete removes the key, its segment is compacted by Compact once at least half of the segment is removed,
+// or removed right away once all of it is removed since nothing's copied
+func (s *Store) Delete(key string) (ok bool) {
+	loc, ok := s.index[key]
+	if !ok {
+		return
+	}
+	delete(s.index, key)
+	seg := loc.segment
+	delete(seg.keys, key)
+	seg.live -= loc.length
+	if seg != s.active && seg.live == 0 {
+		s.remove(seg)
+	}
+	return
+}
+
+// Compact compacts the oldest segment with at least half of it removed, and returns false if there's none.
+// Only one segment is compacted per call, so the caller doesn't hold its lock for long.
+// The live records are kept in the index if compacting fails
+func (s *Store) Compact() (ok bool, err error) {
+	var oldest *segment
+	for _, seg := range s.segments {
+		if seg != s.active && seg.live*2 <= seg.size && (oldest == nil || seg.id < oldest.id) {
+			oldest = seg
+		}
+	}
+	if oldest == nil {
+		return false, nil
+	}
+	if err = s.compact(oldest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// compact moves the live records of the segment to the active segment, and removes the segment.
+// The expired records are dropped instead
+func (s *Store) compact(seg *segment) (err error) {
+	now := time.Now().UnixNano()
+	for key := range seg.keys {
+		loc := s.index[key]
+		delete(seg.keys, key)
+		seg.live -= loc.length
+		if loc.isExpired(now) {
+			delete(s.index, key)
+			if s.onRemove != nil {
+				s.onRemove(key)
+			}
+			continue
+		}
+		value, err := s.read(key, loc)
+		if err == nil {
+			err = s.write(key, value, loc.expiresAt)
+		}
+		if err != nil {
+			// Keep the record in the segment
+			seg.keys[key] = struct{}{}
+			seg.live += loc.length
+			return err
+		}
+	}
+	return s.remove(seg)
+}
+
+// remove closes and removes the segment file
+func (s *Store) remove(seg *segment) (err error) {
+	delete(s.segments, seg.id)
+	_ = seg.file.Close()
+	return os.Remove(seg.file.Name())
+}
+
+// KeysWithPrefix returns the sorted keys with the given prefix
+func (s *Store) KeysWithPrefix(prefix string) (keys []string) {
+	for key := range s.index {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Range calls fn with each key that isn't expired and its expiry time, zero means never, until fn returns false.
+// The keys are ordered by the time they're written, the oldest first
+func (s *Store) Range(fn func(key string, expiry time.Time) bool) {
+	now := time.Now().UnixNano()
+	keys := make([]string, 0, len(s.index))
+	for key, loc := range s.index {
+		if !loc.isExpired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.index[keys[i]], s.index[keys[j]]
+		if a.segment.id != b.segment.id {
+			return a.segment.id < b.segment.id
+		}
+		return a.offset < b.offset
+	})
+	for _, key := range keys {
+		var expiry time.Time
+		if expiresAt := s.index[key].expiresAt; expiresAt != 0 {
+			expiry = time.Unix(0, expiresAt)
+		}
+		if !fn(key, expiry) {
+			return
+		}
+	}
+}
+
+// Len returns the total keys in the store
+func (s *Store) Len() int {
+	return len(s.index)
+}
+
+// Size returns the total bytes of the segment files
+func (s *Store) Size() (size int64) {
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return
+}
+
+// Clear removes all the keys and the segment files
+func (s *Store) Clear() (err error) {
+	if err = s.Close(); err != nil {
+		return
+	}
+	s.segments = map[int]*segment{}
+	s.index = map[string]location{}
+	return s.rotate()
+}
+
+// Close closes and removes the segment files
+func (s *Store) Close() (err error) {
+	for id, seg := range s.segments {
+		_ = seg.file.Close()
+		if err = os.Remove(seg.file.Name()); err != nil {
+			return
+		}
+		delete(s.segments, id)
+	}
+	return
+}
@@ -0,0 +1,288 @@
+package disk_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal/disk"
+)
+
+func TestPutAndGet(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+
+	err = store.Put("key-1", []byte("value-1"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = store.Put("key-1", []byte("value-2"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	value, err := store.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if string(value) != "value-2" {
+		t.Fatalf("expected %v, actual %v", "value-2", string(value))
+	}
+	if store.Len() != 1 {
+		t.Fatalf("expected %v, actual %v", 1, store.Len())
+	}
+
+	if !store.Delete("key-1") {
+		t.Fatalf("expected %v, actual %v", true, false)
+	}
+	_, err = store.Get("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	// Each record is 12 bytes of header, 6 bytes of key and 100 bytes of value, so a segment holds 4 records
+	store, err := disk.Open(dir, 500)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+
+	value := make([]byte, 100)
+	for i := 0; i < 12; i++ {
+		err = store.Put(fmt.Sprintf("key-%02d", i), value)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "segment-*.dat"))
+	if len(segments) != 3 {
+		t.Fatalf("expected %v, actual %v", 3, len(segments))
+	}
+
+	// Removing half of the first segment moves the rest to the active segment on Compact
+	store.Delete("key-00")
+	store.Delete("key-01")
+	if _, err = os.Stat(filepath.Join(dir, "segment-000001.dat")); err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	ok, err := store.Compact()
+	if !ok || err != nil {
+		t.Fatalf("expected %v, actual %v", true, err)
+	}
+	ok, err = store.Compact()
+	if ok || err != nil {
+		t.Fatalf("expected %v, actual %v", false, err)
+	}
+	segments, _ = filepath.Glob(filepath.Join(dir, "segment-*.dat"))
+	if len(segments) != 3 {
+		t.Fatalf("expected %v, actual %v", 3, len(segments))
+	}
+	if _, err = os.Stat(filepath.Join(dir, "segment-000001.dat")); !os.IsNotExist(err) {
+		t.Fatalf("expected %v, actual %v", "compacted", err)
+	}
+	for i := 2; i < 12; i++ {
+		_, err = store.Get(fmt.Sprintf("key-%02d", i))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	if store.Size() != 10*118 {
+		t.Fatalf("expected %v, actual %v", 10*118, store.Size())
+	}
+}
+
+func TestOpenRemovesSegments(t *testing.T) {
+	dir := t.TempDir()
+	store, err := disk.Open(dir, 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = store.Put("key-1", []byte("value-1"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0600)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	store, err = disk.Open(dir, 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+	if store.Len() != 0 {
+		t.Fatalf("expected %v, actual %v", 0, store.Len())
+	}
+	// The other files are kept
+	if _, err = os.Stat(filepath.Join(dir, "other.txt")); err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+	err = store.Put("key-1", []byte("value-1"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = store.Clear()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	_, err = store.Get("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+	err = store.Put("key-2", []byte("value-2"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+
+	for _, key := range []string{"user:2", "order:1", "user:1"} {
+		err = store.Put(key, []byte("value"))
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	keys := store.KeysWithPrefix("user:")
+	if !reflect.DeepEqual(keys, []string{"user:1", "user:2"}) {
+		t.Fatalf("expected %v, actual %v", []string{"user:1", "user:2"}, keys)
+	}
+}
+
+func TestRange(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	err = store.PutWithExpiry("key-2", []byte("value"), expiry)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = store.PutWithExpiry("key-3", []byte("value"), time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	err = store.Put("key-1", []byte("value"))
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	var keys []string
+	expiries := map[string]time.Time{}
+	store.Range(func(key string, expiry time.Time) bool {
+		keys = append(keys, key)
+		expiries[key] = expiry
+		return true
+	})
+	if !reflect.DeepEqual(keys, []string{"key-2", "key-1"}) {
+		t.Fatalf("expected %v, actual %v", []string{"key-2", "key-1"}, keys)
+	}
+	if !expiries["key-2"].Equal(expiry) || !expiries["key-1"].IsZero() {
+		t.Fatalf("expected %v, actual %v", expiry, expiries)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	dir := t.TempDir()
+	// Each record is 12 bytes of header, 6 bytes of key and 100 bytes of value, so a segment holds 4 records
+	store, err := disk.Open(dir, 500)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+	var removed []string
+	store.SetRemovalListener(func(key string) {
+		removed = append(removed, key)
+	})
+
+	value := make([]byte, 100)
+	expiry := time.Now().Add(time.Millisecond * 10)
+	for i := 0; i < 4; i++ {
+		err = store.PutWithExpiry(fmt.Sprintf("key-%02d", i), value, expiry)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	time.Sleep(time.Millisecond * 20)
+	_, err = store.Get("key-00")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+
+	// The expired records are dropped once a new segment is created
+	err = store.Put("key-04", value)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if store.Len() != 1 || len(removed) != 4 {
+		t.Fatalf("expected %v, actual %v", 4, removed)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "segment-*.dat"))
+	if len(segments) != 1 {
+		t.Fatalf("expected %v, actual %v", 1, len(segments))
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	store, err := disk.Open(t.TempDir(), 500)
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	defer store.Close()
+	store.SetMaxSize(1000)
+	var removed []string
+	store.SetRemovalListener(func(key string) {
+		removed = append(removed, key)
+	})
+
+	// The first segment is dropped once the third segment is created
+	value := make([]byte, 100)
+	for i := 0; i < 9; i++ {
+		err = store.Put(fmt.Sprintf("key-%02d", i), value)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	sort.Strings(removed)
+	if !reflect.DeepEqual(removed, []string{"key-00", "key-01", "key-02", "key-03"}) {
+		t.Fatalf("expected %v, actual %v", []string{"key-00", "key-01", "key-02", "key-03"}, removed)
+	}
+	if store.Size() > 1000 {
+		t.Fatalf("expected %v, actual %v", "under 1000", store.Size())
+	}
+	_, err = store.Get("key-00")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+	_, err = store.Get("key-08")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+}
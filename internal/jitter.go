@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Jitter randomizes the expiry time of the stored items, so items stored at the same time
+// will not be expired at the same time
+type Jitter struct {
+	percentage float64
+	absolute   time.Duration
+	rand       *rand.Rand
+	mutex      *sync.Mutex
+}
+
+// NewJitter return the jitter with the given spread. The absolute range takes precedence over the percentage.
+// If both are zero, the jitter will return the expiry time as is
+func NewJitter(percentage float64, absolute time.Duration, src rand.Source) *Jitter {
+	return &Jitter{
+		percentage: percentage,
+		absolute:   absolute,
+		rand:       rand.New(src), //nolint:gosec
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Apply returns the expiry time shifted randomly within [expiry - spread, expiry + spread]
+func (j *Jitter) Apply(expiry time.Duration) time.Duration {
+	if j == nil {
+		return expiry
+	}
+	spread := j.absolute
+	if spread == 0 {
+		spread = time.Duration(float64(expiry) * j.percentage)
+	}
+	if spread <= 0 {
+		return expiry
+	}
+
+	j.mutex.Lock()
+	offset := time.Duration(j.rand.Int63n(int64(2*spread)+1)) - spread
+	j.mutex.Unlock()
+
+	expiry += offset
+	if expiry <= 0 {
+		// Never store an item that is already expired
+		expiry = time.Nanosecond
+	}
+	return expiry
+}
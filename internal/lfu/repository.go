@@ -3,10 +3,12 @@ package lfu
 import (
 	"container/list"
 	"encoding/json"
-	"reflect"
+	"strings"
 	"time"
 
 	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
+	"github.com/bxcodec/gotcha/internal/radix"
 )
 
 // Repository represent the data repository for inernal cache
@@ -16,19 +18,33 @@ type Repository struct {
 	maxSize        uint64
 	maxMemory      uint64
 	expiryTreshold time.Duration
+	jitter         *internal.Jitter
+	resetFrequency bool        // reset the frequency of the updated item
+	index          *radix.Tree // optional index of the keys for the prefix lookup
+	onRemove       func(doc *cache.Document)
+	onEvict        func(doc *cache.Document)
+	memory         *internal.Memory // optional size of the items, instead of encoding all the items to JSON
 }
 
 type lfuItem struct {
 	FreqParent *list.Element
 	Data       *cache.Document
+	element    *list.Element // the position of the item in the items of the FreqParent
 }
 
 type frequencyItem struct {
 	Frequency uint64
-	// TODO: (bxcodec) Change to Set Data structures if possible
-	// In the paper of Prof. Ketan Shah this items using SET
-	// since SET is not available in Golang, I just use Map here
-	items map[*lfuItem]bool
+	// In the paper of Prof. Ketan Shah this items using SET.
+	// Here the items are stored in a list ordered by the time they reached this frequency,
+	// so the oldest item is always in the front and can be evicted in O(1)
+	items *list.List
+}
+
+func newFrequencyItem(frequency uint64) *frequencyItem {
+	return &frequencyItem{
+		Frequency: frequency,
+		items:     list.New(),
+	}
 }
 
 // New will initialize the LFU memory cache
@@ -53,102 +69,187 @@ func (r *Repository) Get(key string) (res *cache.Document, err error) {
 	res = tmp.Data
 
 	//  Check Expiry and Remove the expired item
-	storedTime := time.Unix(res.StoredTime, 0)
-	if time.Since(storedTime) > r.expiryTreshold {
+	if res.IsExpired() {
 		_, _ = r.Delete(key)
 		return nil, cache.ErrMissed
 	}
 
 	freq := tmp.FreqParent
+	freqVal := freq.Value.(*frequencyItem)
 	nextFreq := freq.Next()
-	if nextFreq == nil {
-		nextFreq = freq
+	if nextFreq == nil || nextFreq.Value.(*frequencyItem).Frequency != freqVal.Frequency+1 {
+		nextFreq = r.frequencyList.InsertAfter(newFrequencyItem(freqVal.Frequency+1), freq)
 	}
+	r.detach(tmp)
+	r.attach(tmp, nextFreq)
 
-	freqVal := freq.Value.(*frequencyItem)
-	nextFreqVal := nextFreq.Value.(*frequencyItem)
-	headFreq := r.frequencyList.Front()
-	if nextFreq == headFreq || nextFreqVal.Frequency != (freqVal.Frequency+1) {
-		newNodeFreq := &frequencyItem{
-			Frequency: freqVal.Frequency + 1,
-		}
-		nextFreq = r.frequencyList.InsertAfter(newNodeFreq, freq)
-	}
+	return res, nil
+}
 
-	nextFreqVal = nextFreq.Value.(*frequencyItem)
-	if len(nextFreqVal.items) == 0 {
-		nextFreqVal.items = make(map[*lfuItem]bool)
-	}
-	nextFreqVal.items[tmp] = true
-	tmp.FreqParent = nextFreq
-	delete(freqVal.items, tmp)
-	if len(freqVal.items) == 0 {
-		r.frequencyList.Remove(freq)
+// Peek will retrieve the item from cache without updating the frequency of the item
+func (r *Repository) Peek(key string) (res *cache.Document, err error) {
+	tmp := r.byKey[key]
+	if tmp == nil {
+		err = cache.ErrMissed
+		return
 	}
+	res = tmp.Data
+	return
+}
 
-	return res, nil
+// PeekMetadata will retrieve the item from cache without updating its frequency, the same as Peek
+func (r *Repository) PeekMetadata(key string) (res *cache.Document, err error) {
+	return r.Peek(key)
+}
+
+// SetJitter will randomize the expiry time of the items stored afterwards
+func (r *Repository) SetJitter(jitter *internal.Jitter) {
+	r.jitter = jitter
+}
+
+// SetResetFrequency defines whether updating an existing item will reset its frequency.
+// By default the frequency of the updated item is kept
+func (r *Repository) SetResetFrequency(reset bool) {
+	r.resetFrequency = reset
+}
+
+// SetKeyIndex will maintain the keys in the given radix tree, so KeysWithPrefix doesn't scan all the keys.
+// It must be set before any item is stored
+func (r *Repository) SetKeyIndex(index *radix.Tree) {
+	r.index = index
+}
+
+// SetRemovalListener will call fn with the document removed from the cache, either deleted, evicted,
+// expired or replaced by the new document with the same key. It's not called by Clear
+func (r *Repository) SetRemovalListener(fn func(doc *cache.Document)) {
+	r.onRemove = fn
+}
+
+// SetMemory will measure the max memory with the size of each item tracked by the memory,
+// instead of encoding all the items to JSON on every write. It must be set before any item is stored
+func (r *Repository) SetMemory(memory *internal.Memory) {
+	r.memory = memory
+}
+
+// SetEvictionListener will call fn with the document evicted because the max size or the max memory reached,
+// after the removal listener
+func (r *Repository) SetEvictionListener(fn func(doc *cache.Document)) {
+	r.onEvict = fn
 }
 
 // Set wil save the item to cache
 func (r *Repository) Set(doc *cache.Document) (err error) {
-	if _, ok := r.byKey[doc.Key]; ok {
-		// TODO: (bxcodec)
-		// Re-insert the document
-		return
+	if doc.TTL == 0 {
+		doc.TTL = r.jitter.Apply(r.expiryTreshold)
 	}
 
-	freq := r.frequencyList.Front() // Front will always be the least frequently used
-	if freq == nil {
-		newNodeFreq := &frequencyItem{
-			Frequency: 1,
-		}
-		freq = r.frequencyList.PushFront(newNodeFreq)
-		freqVal := freq.Value.(*frequencyItem)
-		item := &lfuItem{
-			FreqParent: freq,
-			Data:       doc,
+	if item, ok := r.byKey[doc.Key]; ok {
+		if !r.resetFrequency {
+			if r.onRemove != nil {
+				r.onRemove(item.Data)
+			}
+			item.Data = doc
+			return r.removeByMemory(doc.Key)
 		}
+		// Re-insert the document as a new item with frequency 1
+		_, _ = r.Delete(doc.Key)
+	}
 
-		freqVal.items = map[*lfuItem]bool{
-			item: true,
-		}
-		r.byKey[doc.Key] = item
-		return
+	return r.insert(doc, 1)
+}
+
+// SetWithFrequency will save the item to cache with the given frequency, e.g to restore the frequency
+// from a snapshot. The existing item with the same key is replaced regardless of its frequency
+func (r *Repository) SetWithFrequency(doc *cache.Document, frequency uint64) (err error) {
+	if doc.TTL == 0 {
+		doc.TTL = r.jitter.Apply(r.expiryTreshold)
+	}
+	if frequency == 0 {
+		frequency = 1
 	}
+	_, _ = r.Delete(doc.Key)
+	return r.insert(doc, frequency)
+}
 
-	freqVal := freq.Value.(*frequencyItem)
-	if freqVal.Frequency != 1 {
-		newNodeFreq := &frequencyItem{
-			Frequency: 1,
-			items:     make(map[*lfuItem]bool),
-		}
-		freq = r.frequencyList.PushFront(newNodeFreq)
+// insert appends the new item to the given frequency
+func (r *Repository) insert(doc *cache.Document, frequency uint64) (err error) {
+	// TODO: (bxcodec)
+	// Move this to go-routine if possible
+	// Remove oldest if the max-size reached, before inserting the new item
+	// so the new item will never be evicted directly
+	if uint64(len(r.byKey)) >= r.maxSize {
+		r.removeLfuOldest()
 	}
 
-	freqVal = freq.Value.(*frequencyItem)
+	// Front will always be the least frequently used
+	freq := r.frequencyList.Front()
+	for freq != nil && freq.Value.(*frequencyItem).Frequency < frequency {
+		freq = freq.Next()
+	}
+	switch {
+	case freq == nil:
+		freq = r.frequencyList.PushBack(newFrequencyItem(frequency))
+	case freq.Value.(*frequencyItem).Frequency != frequency:
+		freq = r.frequencyList.InsertBefore(newFrequencyItem(frequency), freq)
+	}
 	item := &lfuItem{
-		FreqParent: freq,
-		Data:       doc,
+		Data: doc,
 	}
-
-	freqVal.items[item] = true
+	r.attach(item, freq)
 	r.byKey[doc.Key] = item
+	if r.index != nil {
+		r.index.Insert(doc.Key)
+	}
 
-	// TODO: (bxcodec)
-	// Move this to go-routine if possible
-	// Remove oldest if the max-size reached
-	if uint64(len(r.byKey)) > r.maxSize {
-		r.removeLfuOldest()
+	return r.removeByMemory(doc.Key)
+}
+
+// Frequency return the frequency of the item, or zero if the item doesn't exist
+func (r *Repository) Frequency(key string) (frequency uint64) {
+	if item, ok := r.byKey[key]; ok {
+		frequency = item.FreqParent.Value.(*frequencyItem).Frequency
 	}
+	return
+}
 
+// attach appends the item to the items of the given frequency
+func (r *Repository) attach(item *lfuItem, freq *list.Element) {
+	item.FreqParent = freq
+	item.element = freq.Value.(*frequencyItem).items.PushBack(item)
+}
+
+// detach removes the item from its frequency, and removes the frequency if it's empty
+func (r *Repository) detach(item *lfuItem) {
+	freqVal := item.FreqParent.Value.(*frequencyItem)
+	freqVal.items.Remove(item.element)
+	if freqVal.items.Len() == 0 {
+		r.frequencyList.Remove(item.FreqParent)
+	}
+}
+
+// removeByMemory removes the least frequently used item if the max memory reached,
+// or the items until the max memory is not exceeded if the memory is set.
+// The item with the given key will be removed if it can't be encoded
+func (r *Repository) removeByMemory(key string) (err error) {
 	// Avoid memory limit if set zero to increase performances
 	if r.maxMemory == 0 {
 		return
 	}
 
+	if r.memory != nil {
+		if err = r.memory.Add(r.byKey[key].Data); err != nil {
+			_, _ = r.Delete(key)
+			return
+		}
+		for r.memory.Total() > r.maxMemory && len(r.byKey) > 0 {
+			r.removeLfuOldest()
+		}
+		return
+	}
+
 	byteMap, err := json.Marshal(r.byKey)
 	if err != nil {
-		_, _ = r.Delete(doc.Key)
+		_, _ = r.Delete(key)
 		return
 	}
 	// Remove oldest if the maxmemory reached
@@ -158,34 +259,47 @@ func (r *Repository) Set(doc *cache.Document) (err error) {
 	return nil
 }
 
+// removeLfuOldest removes the oldest item from the least frequently used items, the item that reached
+// the frequency first regardless of its StoredTime
 func (r *Repository) removeLfuOldest() {
 	lfuList := r.frequencyList.Front()
-	if r.frequencyList.Len() == 0 {
+	if lfuList == nil {
 		return
 	}
-	freqItem := lfuList.Value.(*frequencyItem)
+	oldestItem := lfuList.Value.(*frequencyItem).items.Front().Value.(*lfuItem)
 
-	minStoreTime := time.Now().Unix()
-	var oldestItem *lfuItem
-	// Search for the oldest one with store time
-	for item := range freqItem.items {
-		if item.Data.StoredTime < minStoreTime {
-			minStoreTime = item.Data.StoredTime
-			oldestItem = item
-		}
+	// Remove from Cache
+	_, _ = r.Delete(oldestItem.Data.Key)
+	if r.onEvict != nil {
+		r.onEvict(oldestItem.Data)
 	}
+}
 
-	if oldestItem == nil && len(freqItem.items) > 0 {
-		//  Get randomly
-		oldestItem = reflect.ValueOf(freqItem.items).MapKeys()[0].Interface().(*lfuItem)
+// PopLeastFrequent removes and returns the oldest item from the least frequently used items
+func (r *Repository) PopLeastFrequent() (res *cache.Document, err error) {
+	lfuList := r.frequencyList.Front()
+	if lfuList == nil {
+		return nil, cache.ErrMissed
 	}
+	res = lfuList.Value.(*frequencyItem).items.Front().Value.(*lfuItem).Data
+	_, err = r.Delete(res.Key)
+	return
+}
 
-	// Remove from Cache
-	delete(freqItem.items, oldestItem)
-	delete(r.byKey, oldestItem.Data.Key)
-	if len(freqItem.items) == 0 {
-		r.frequencyList.Remove(lfuList)
+// PopOldest removes and returns the item with the oldest stored time regardless of its frequency.
+// It scans all the items, use PopLeastFrequent for the O(1) removal
+func (r *Repository) PopOldest() (res *cache.Document, err error) {
+	r.Range(func(doc *cache.Document) bool {
+		if res == nil || doc.StoredTime < res.StoredTime {
+			res = doc
+		}
+		return true
+	})
+	if res == nil {
+		return nil, cache.ErrMissed
 	}
+	_, err = r.Delete(res.Key)
+	return
 }
 
 // Clear will clear up the item from cache
@@ -194,6 +308,12 @@ func (r *Repository) Clear() (err error) {
 		delete(r.byKey, k)
 	}
 	r.frequencyList.Init()
+	if r.index != nil {
+		r.index.Clear()
+	}
+	if r.memory != nil {
+		r.memory.Clear()
+	}
 	return
 }
 
@@ -208,6 +328,20 @@ func (r *Repository) Contains(key string) (ok bool) {
 	return
 }
 
+// SetTTL will change the expiry time of the item without updating its frequency
+func (r *Repository) SetTTL(key string, storedTime int64, ttl time.Duration) (err error) {
+	item, ok := r.byKey[key]
+	if !ok {
+		return cache.ErrMissed
+	}
+	// The document is copied, since the stored document may be read outside the lock of the cache
+	updated := *item.Data
+	updated.StoredTime = storedTime
+	updated.TTL = ttl
+	item.Data = &updated
+	return
+}
+
 // Delete will delete the item from cache
 func (r *Repository) Delete(key string) (ok bool, err error) {
 	lfuItem, ok := r.byKey[key]
@@ -215,19 +349,63 @@ func (r *Repository) Delete(key string) (ok bool, err error) {
 		return
 	}
 
-	freqItem := lfuItem.FreqParent.Value.(*frequencyItem)
-	delete(freqItem.items, lfuItem)
-	if len(freqItem.items) == 0 {
-		r.frequencyList.Remove(lfuItem.FreqParent)
-	}
+	r.detach(lfuItem)
 	delete(r.byKey, key)
+	if r.index != nil {
+		r.index.Delete(key)
+	}
+	if r.memory != nil {
+		r.memory.Remove(key)
+	}
+	if r.onRemove != nil {
+		r.onRemove(lfuItem.Data)
+	}
 	return
 }
 
-// Keys return all keys from cache
-func (r *Repository) Keys() (keys []string, err error) {
-	for k := range r.byKey {
-		keys = append(keys, k)
+// Range calls fn for each document in the cache, from the least frequently used
+// and the oldest within the same frequency, until fn returns false.
+// It doesn't update the frequency of the keys.
+func (r *Repository) Range(fn func(doc *cache.Document) bool) {
+	for freq := r.frequencyList.Front(); freq != nil; freq = freq.Next() {
+		for elem := freq.Value.(*frequencyItem).items.Front(); elem != nil; elem = elem.Next() {
+			if !fn(elem.Value.(*lfuItem).Data) {
+				return
+			}
+		}
 	}
+}
+
+// RangeMetadata calls fn for each document in the cache, the same as Range
+func (r *Repository) RangeMetadata(fn func(doc *cache.Document) bool) {
+	r.Range(fn)
+}
+
+// KeysWithPrefix return the keys with the given prefix, in lexical order if the key index is set,
+// otherwise from the least frequently used
+func (r *Repository) KeysWithPrefix(prefix string) (keys []string) {
+	if r.index != nil {
+		r.index.WalkPrefix(prefix, func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		return
+	}
+	r.Range(func(doc *cache.Document) bool {
+		if strings.HasPrefix(doc.Key, prefix) {
+			keys = append(keys, doc.Key)
+		}
+		return true
+	})
+	return
+}
+
+// Keys return all keys from cache, from the least frequently used
+func (r *Repository) Keys() (keys []string, err error) {
+	keys = make([]string, 0, len(r.byKey))
+	r.Range(func(doc *cache.Document) bool {
+		keys = append(keys, doc.Key)
+		return true
+	})
 	return
 }
@@ -6,8 +6,10 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"reflect"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"testing"
 	"time"
 
@@ -66,6 +68,139 @@ func TestSetWithMultipleKeyExists(t *testing.T) {
 	}
 }
 
+func TestSetWithExistingKey(t *testing.T) {
+	arrDoc := []*cache.Document{
+		{
+			Key:        "key-1",
+			Value:      "Hello World 1",
+			StoredTime: time.Now().Unix(),
+		},
+		{
+			Key:        "key-2",
+			Value:      "Hello World 2",
+			StoredTime: time.Now().Unix(),
+		},
+		{
+			Key:        "key-1",
+			Value:      "Hello World 1 Modified",
+			StoredTime: time.Now().Unix(),
+		},
+		{
+			Key:        "key-3",
+			Value:      "Hello World 3 Modified",
+			StoredTime: time.Now().Unix(),
+		},
+		{
+			Key:        "key-1",
+			Value:      "Hello World 1 Modified Twice",
+			StoredTime: time.Now().Unix(),
+		},
+	}
+
+	repo := repository.New(10, 500, time.Minute*5)
+	for _, doc := range arrDoc {
+		err := repo.Set(doc)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	// Since the key is only 3 are different even the item to be set are 5
+	if repo.Len() != 3 {
+		t.Fatalf("expected %v, actual %v", 3, repo.Len())
+	}
+
+	res, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if res.Value != arrDoc[4].Value {
+		t.Fatalf("expected %v, actual %v", arrDoc[4].Value, res.Value)
+	}
+}
+
+func TestSetWithExistingKeyFrequency(t *testing.T) {
+	setItems := func(repo *repository.Repository) {
+		err := repo.Set(&cache.Document{Key: "key-1", Value: "A", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		for i := 0; i < 2; i++ {
+			_, err = repo.Get("key-1")
+			if err != nil {
+				t.Fatalf("expected %v, actual %v", nil, err)
+			}
+		}
+		// Update the frequently used item before key-2 is stored, so key-1 is the oldest item
+		// if the frequency is reset. The ties are broken by the order the items reached the frequency,
+		// not by the StoredTime, so the items are stored in the order instead of with backdated StoredTime
+		// as before the O(1) eviction
+		err = repo.Set(&cache.Document{Key: "key-1", Value: "A'", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		err = repo.Set(&cache.Document{Key: "key-2", Value: "B", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		err = repo.Set(&cache.Document{Key: "key-3", Value: "C", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	t.Run("keep-frequency", func(t *testing.T) {
+		repo := repository.New(2, 0, time.Minute*5)
+		setItems(repo)
+
+		res, err := repo.Get("key-1")
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if res.Value != "A'" {
+			t.Fatalf("expected %v, actual %v", "A'", res.Value)
+		}
+		if repo.Contains("key-2") {
+			t.Fatalf("expected %v, actual %v", false, true)
+		}
+	})
+
+	t.Run("reset-frequency", func(t *testing.T) {
+		repo := repository.New(2, 0, time.Minute*5)
+		repo.SetResetFrequency(true)
+		setItems(repo)
+
+		if repo.Contains("key-1") {
+			t.Fatalf("expected %v, actual %v", false, true)
+		}
+		res, err := repo.Get("key-2")
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if res.Value != "B" {
+			t.Fatalf("expected %v, actual %v", "B", res.Value)
+		}
+	})
+
+	t.Run("max-memory", func(t *testing.T) {
+		repo := repository.New(10, 300, time.Minute*5)
+		for _, key := range []string{"key-1", "key-2"} {
+			err := repo.Set(&cache.Document{Key: key, Value: "A", StoredTime: time.Now().Unix()})
+			if err != nil {
+				t.Fatalf("expected %v, actual %v", nil, err)
+			}
+		}
+		// Updating with a bigger value will evict the least frequently used item
+		err := repo.Set(&cache.Document{Key: "key-2", Value: strings.Repeat("B", 100), StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if repo.Len() != 1 {
+			t.Fatalf("expected %v, actual %v", 1, repo.Len())
+		}
+	})
+}
+
 func TestGetOne(t *testing.T) {
 	repo := repository.New(5, 500, time.Second*5)
 	doc := &cache.Document{
@@ -422,6 +557,38 @@ func TestContains(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	repo := repository.New(2, 0, time.Minute*5)
+	for _, key := range []string{"key-1", "key-2"} {
+		err := repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Add(time.Second * -1).Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	// Peek will not increase the frequency, so key-1 still can be evicted
+	res, err := repo.Peek("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if res.Value != "key-1" {
+		t.Fatalf("expected %v, actual %v", "key-1", res.Value)
+	}
+	_, err = repo.Get("key-2")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	err = repo.Set(&cache.Document{Key: "key-3", Value: "key-3", StoredTime: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	_, err = repo.Peek("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+}
+
 func TestDelete(t *testing.T) {
 	repo := repository.New(4, 500, time.Second*5)
 	arrDoc := []*cache.Document{
@@ -527,6 +694,192 @@ func TestGetKeys(t *testing.T) {
 	}
 }
 
+func TestEvictionOrder(t *testing.T) {
+	repo := repository.New(4, 0, time.Minute*5)
+	for i := 1; i <= 4; i++ {
+		err := repo.Set(&cache.Document{Key: fmt.Sprintf("key-%d", i), Value: i, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	// key-3 and key-1 are promoted to frequency 2, in that order
+	for _, key := range []string{"key-3", "key-1"} {
+		_, err := repo.Get(key)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	keys, err := repo.Keys()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	expectedKeys := []string{"key-2", "key-4", "key-3", "key-1"}
+	if fmt.Sprint(keys) != fmt.Sprint(expectedKeys) {
+		t.Fatalf("expected %v, actual %v", expectedKeys, keys)
+	}
+
+	// The oldest with the lowest frequency is always evicted first,
+	// the new items have the lowest frequency once key-2 and key-4 are evicted
+	for i, evicted := range []string{"key-2", "key-4", "new-key-0", "new-key-1"} {
+		err := repo.Set(&cache.Document{Key: fmt.Sprintf("new-key-%d", i), Value: i, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if repo.Contains(evicted) {
+			t.Fatalf("expected %v evicted, actual %v", evicted, "exists")
+		}
+		if repo.Len() != 4 {
+			t.Fatalf("expected %v, actual %v", 4, repo.Len())
+		}
+	}
+	for _, key := range []string{"key-3", "key-1"} {
+		if !repo.Contains(key) {
+			t.Fatalf("expected %v exists, actual %v", key, "evicted")
+		}
+	}
+}
+
+func TestPop(t *testing.T) {
+	repo := repository.New(10, 0, time.Minute*5)
+	arrDoc := []*cache.Document{
+		{Key: "key-1", Value: "A", StoredTime: time.Now().Add(time.Second * -30).Unix()},
+		{Key: "key-2", Value: "B", StoredTime: time.Now().Add(time.Second * -20).Unix()},
+		{Key: "key-3", Value: "C", StoredTime: time.Now().Add(time.Second * -10).Unix()},
+	}
+	for _, doc := range arrDoc {
+		err := repo.Set(doc)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	res, err := repo.PopLeastFrequent()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if res.Key != "key-2" {
+		t.Fatalf("expected %v, actual %v", "key-2", res.Key)
+	}
+
+	// The oldest stored time regardless of the frequency
+	res, err = repo.PopOldest()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if res.Key != "key-1" {
+		t.Fatalf("expected %v, actual %v", "key-1", res.Key)
+	}
+
+	_, err = repo.PopLeastFrequent()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	_, err = repo.PopLeastFrequent()
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+	_, err = repo.PopOldest()
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+}
+
+func TestRemovalListener(t *testing.T) {
+	repo := repository.New(2, 0, time.Minute*5)
+	removed := []string{}
+	repo.SetRemovalListener(func(doc *cache.Document) {
+		removed = append(removed, fmt.Sprintf("%s=%v", doc.Key, doc.Value))
+	})
+
+	for i, key := range []string{"key-1", "key-2", "key-1", "key-3"} {
+		err := repo.Set(&cache.Document{Key: key, Value: i, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Delete("key-3")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	// key-1 is replaced, then evicted since updating doesn't change its frequency, and key-3 is deleted
+	expected := "[key-1=0 key-1=2 key-3=3]"
+	if fmt.Sprint(removed) != expected {
+		t.Fatalf("expected %v, actual %v", expected, removed)
+	}
+}
+
+func TestSetWithFrequency(t *testing.T) {
+	repo := repository.New(3, 0, time.Minute*5)
+	for key, frequency := range map[string]uint64{"key-1": 3, "key-2": 1, "key-3": 2} {
+		err := repo.SetWithFrequency(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()}, frequency)
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	if repo.Frequency("key-1") != 3 {
+		t.Fatalf("expected %v, actual %v", 3, repo.Frequency("key-1"))
+	}
+
+	keys, err := repo.Keys()
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	expected := []string{"key-2", "key-3", "key-1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %v, actual %v", expected, keys)
+	}
+
+	// The least frequently used item is evicted for the new item
+	err = repo.Set(&cache.Document{Key: "key-4", Value: "key-4", StoredTime: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if repo.Contains("key-2") {
+		t.Fatalf("expected %v, actual %v", "evicted", "key-2")
+	}
+}
+
+func TestEvictionListener(t *testing.T) {
+	repo := repository.New(2, 0, time.Minute*5)
+	evicted := []string{}
+	repo.SetEvictionListener(func(doc *cache.Document) {
+		evicted = append(evicted, doc.Key)
+	})
+
+	for _, key := range []string{"key-1", "key-2"} {
+		err := repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	// The deleted item is not evicted
+	_, err = repo.Delete("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	for _, key := range []string{"key-3", "key-4"} {
+		err = repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	expected := "[key-2]"
+	if fmt.Sprint(evicted) != expected {
+		t.Fatalf("expected %v, actual %v", expected, evicted)
+	}
+}
+
 // This benchmark code below also used for profiling to get the memory and CPU usage
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
@@ -597,3 +950,57 @@ func BenchmarkSetItem(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkSetWithEviction proves the eviction doesn't depend on the number of items
+// with the same frequency, the ns/op should be similar for each size
+func BenchmarkSetWithEviction(b *testing.B) {
+	for _, size := range []uint64{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("size-%d", size), func(b *testing.B) {
+			repo := repository.New(size, 0, time.Minute*40)
+			docs := make([]*cache.Document, size+uint64(b.N))
+			for i := range docs {
+				docs[i] = &cache.Document{
+					Key:        fmt.Sprintf("key-%d", i),
+					Value:      i,
+					StoredTime: time.Now().Unix(),
+				}
+			}
+			// Fill the cache, so every Set below will evict an item with frequency 1
+			for _, doc := range docs[:size] {
+				_ = repo.Set(doc)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, doc := range docs[size:] {
+				err := repo.Set(doc)
+				if err != nil {
+					b.Fatalf("expected %v, actual %v", nil, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetWithPromotion measures the promotion of an item to the next frequency
+func BenchmarkGetWithPromotion(b *testing.B) {
+	for _, size := range []uint64{1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("size-%d", size), func(b *testing.B) {
+			repo := repository.New(size, 0, time.Minute*40)
+			keys := make([]string, size)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key-%d", i)
+				_ = repo.Set(&cache.Document{Key: keys[i], Value: i, StoredTime: time.Now().Unix()})
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := repo.Get(keys[i%len(keys)])
+				if err != nil {
+					b.Fatalf("expected %v, actual %v", nil, err)
+				}
+			}
+		})
+	}
+}
@@ -3,9 +3,12 @@ package lru
 import (
 	"container/list"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
+	"github.com/bxcodec/gotcha/internal/radix"
 )
 
 // Repository implements the Repository cache
@@ -15,6 +18,11 @@ type Repository struct {
 	fragmentPositionList *list.List
 	items                map[string]*list.Element
 	expiryTresHold       time.Duration
+	jitter               *internal.Jitter
+	index                *radix.Tree // optional index of the keys for the prefix lookup
+	onRemove             func(doc *cache.Document)
+	onEvict              func(doc *cache.Document)
+	memory               *internal.Memory // optional size of the items, instead of encoding all the items to JSON
 }
 
 // New constructs an Repository of the given size
@@ -29,25 +37,80 @@ func New(size, memory uint64, expiryTresHold time.Duration) *Repository {
 	return c
 }
 
+// SetJitter will randomize the expiry time of the items stored afterwards
+func (r *Repository) SetJitter(jitter *internal.Jitter) {
+	r.jitter = jitter
+}
+
+// SetKeyIndex will maintain the keys in the given radix tree, so KeysWithPrefix doesn't scan all the keys.
+// It must be set before any item is stored
+func (r *Repository) SetKeyIndex(index *radix.Tree) {
+	r.index = index
+}
+
+// SetRemovalListener will call fn with the document removed from the cache, either deleted, evicted,
+// expired or replaced by the new document with the same key. It's not called by Clear
+func (r *Repository) SetRemovalListener(fn func(doc *cache.Document)) {
+	r.onRemove = fn
+}
+
+// SetMemory will measure the max memory with the size of each item tracked by the memory,
+// instead of encoding all the items to JSON on every write. It must be set before any item is stored
+func (r *Repository) SetMemory(memory *internal.Memory) {
+	r.memory = memory
+}
+
+// SetEvictionListener will call fn with the document evicted because the max size or the max memory reached,
+// after the removal listener
+func (r *Repository) SetEvictionListener(fn func(doc *cache.Document)) {
+	r.onEvict = fn
+}
+
 // Set adds a value to the cache.  Returns true if an eviction occurred.
 func (r *Repository) Set(doc *cache.Document) (err error) {
+	if doc.TTL == 0 {
+		doc.TTL = r.jitter.Apply(r.expiryTresHold)
+	}
+
 	// Check for existing item
 	if elem, ok := r.items[doc.Key]; ok {
 		// TODO: (bxcodec)
 		// Check the expiry item
 		r.fragmentPositionList.MoveToFront(elem)
+		if r.onRemove != nil {
+			r.onRemove(elem.Value.(*cache.Document))
+		}
 		elem.Value = doc
-		return nil
+		return r.removeByMemory(doc)
 	}
 
 	elem := r.fragmentPositionList.PushFront(doc)
 	r.items[doc.Key] = elem
+	if r.index != nil {
+		r.index.Insert(doc.Key)
+	}
 
 	// Remove the oldest if the fragment is full
 	if uint64(r.fragmentPositionList.Len()) > r.maxSize {
 		r.removeOldest()
 	}
 
+	return r.removeByMemory(doc)
+}
+
+// removeByMemory measures the stored or updated document, and removes the oldest items if the max memory
+// is exceeded. The document is removed if it can't be measured
+func (r *Repository) removeByMemory(doc *cache.Document) (err error) {
+	if r.memory != nil {
+		if err = r.memory.Add(doc); err != nil {
+			_, _ = r.Delete(doc.Key)
+			return
+		}
+		for r.memory.Total() > r.maxMemory && r.fragmentPositionList.Len() > 0 {
+			r.removeOldest()
+		}
+		return
+	}
 	// To increase performances Avoid memory limit if the maxMemory is zero
 	if r.maxMemory == 0 {
 		return
@@ -70,8 +133,7 @@ func (r *Repository) Set(doc *cache.Document) (err error) {
 func (r *Repository) Get(key string) (res *cache.Document, err error) {
 	if elem, ok := r.items[key]; ok {
 		res = elem.Value.(*cache.Document)
-		storedTime := time.Unix(res.StoredTime, 0)
-		if time.Since(storedTime) > r.expiryTresHold { // if expired, delete directly
+		if res.IsExpired() { // if expired, delete directly
 			_, _ = r.Delete(key)
 			return nil, cache.ErrMissed
 		}
@@ -92,6 +154,32 @@ func (r *Repository) GetOldest() (res *cache.Document, err error) {
 	return
 }
 
+// SetWithFrequency will save the item to cache, the frequency is ignored since LRU doesn't track it
+func (r *Repository) SetWithFrequency(doc *cache.Document, frequency uint64) (err error) {
+	return r.Set(doc)
+}
+
+// Frequency always return zero, since LRU doesn't track the frequency of the items
+func (r *Repository) Frequency(key string) (frequency uint64) {
+	return 0
+}
+
+// PopOldest removes and returns the least recently used element
+func (r *Repository) PopOldest() (res *cache.Document, err error) {
+	elem := r.fragmentPositionList.Back()
+	if elem == nil {
+		return nil, cache.ErrMissed
+	}
+	r.removeElement(elem)
+	res = elem.Value.(*cache.Document)
+	return
+}
+
+// PopLeastFrequent is not supported, since LRU doesn't track the frequency of the elements
+func (r *Repository) PopLeastFrequent() (res *cache.Document, err error) {
+	return nil, cache.ErrNotSupported
+}
+
 // Contains checks if a key is in the cache, without updating the recent-ness
 // or deleting it for being stale.
 func (r *Repository) Contains(key string) (ok bool) {
@@ -110,6 +198,25 @@ func (r *Repository) Peek(key string) (res *cache.Document, err error) {
 	return
 }
 
+// PeekMetadata will retrieve the item from cache without updating its recent-ness, the same as Peek
+func (r *Repository) PeekMetadata(key string) (res *cache.Document, err error) {
+	return r.Peek(key)
+}
+
+// SetTTL will change the expiry time of the item without updating its recent-ness
+func (r *Repository) SetTTL(key string, storedTime int64, ttl time.Duration) (err error) {
+	elem, ok := r.items[key]
+	if !ok {
+		return cache.ErrMissed
+	}
+	// The document is copied, since the stored document may be read outside the lock of the cache
+	updated := *elem.Value.(*cache.Document)
+	updated.StoredTime = storedTime
+	updated.TTL = ttl
+	elem.Value = &updated
+	return
+}
+
 // Delete removes the provided key from the cache, returning if the
 // key was contained.
 func (r *Repository) Delete(key string) (ok bool, err error) {
@@ -126,6 +233,15 @@ func (r *Repository) removeElement(e *list.Element) {
 	r.fragmentPositionList.Remove(e)
 	doc := e.Value.(*cache.Document)
 	delete(r.items, doc.Key)
+	if r.index != nil {
+		r.index.Delete(doc.Key)
+	}
+	if r.memory != nil {
+		r.memory.Remove(doc.Key)
+	}
+	if r.onRemove != nil {
+		r.onRemove(doc)
+	}
 }
 
 // removeOldest removes the oldest item from the cache.
@@ -133,6 +249,9 @@ func (r *Repository) removeOldest() {
 	elem := r.fragmentPositionList.Back()
 	if elem != nil {
 		r.removeElement(elem)
+		if r.onEvict != nil {
+			r.onEvict(elem.Value.(*cache.Document))
+		}
 	}
 }
 
@@ -147,6 +266,40 @@ func (r *Repository) Keys() (keys []string, err error) {
 	return
 }
 
+// RangeMetadata calls fn for each document in the cache, the same as Range
+func (r *Repository) RangeMetadata(fn func(doc *cache.Document) bool) {
+	r.Range(fn)
+}
+
+// Range calls fn for each document in the cache, from oldest to newest,
+// until fn returns false. It doesn't update the recent-ness of the keys.
+func (r *Repository) Range(fn func(doc *cache.Document) bool) {
+	for elem := r.fragmentPositionList.Back(); elem != nil; elem = elem.Prev() {
+		if !fn(elem.Value.(*cache.Document)) {
+			return
+		}
+	}
+}
+
+// KeysWithPrefix returns the keys with the given prefix, in lexical order if the key index is set,
+// otherwise from oldest to newest
+func (r *Repository) KeysWithPrefix(prefix string) (keys []string) {
+	if r.index != nil {
+		r.index.WalkPrefix(prefix, func(key string) bool {
+			keys = append(keys, key)
+			return true
+		})
+		return
+	}
+	r.Range(func(doc *cache.Document) bool {
+		if strings.HasPrefix(doc.Key, prefix) {
+			keys = append(keys, doc.Key)
+		}
+		return true
+	})
+	return
+}
+
 // Len returns the number of items in the cache.
 func (r *Repository) Len() (itemLen int64) {
 	itemLen = int64(r.fragmentPositionList.Len())
@@ -159,5 +312,11 @@ func (r *Repository) Clear() (err error) {
 		delete(r.items, k)
 	}
 	r.fragmentPositionList.Init()
+	if r.index != nil {
+		r.index.Clear()
+	}
+	if r.memory != nil {
+		r.memory.Clear()
+	}
 	return
 }
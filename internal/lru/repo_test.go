@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
 	repository "github.com/bxcodec/gotcha/internal/lru"
 )
 
@@ -201,6 +202,140 @@ func TestGetOldest(t *testing.T) {
 	}
 }
 
+func TestPopOldest(t *testing.T) {
+	repo := repository.New(10, 0, time.Minute*5)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	for _, expected := range []string{"key-2", "key-3", "key-1"} {
+		res, err := repo.PopOldest()
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+		if res.Key != expected {
+			t.Fatalf("expected %v, actual %v", expected, res.Key)
+		}
+	}
+	_, err = repo.PopOldest()
+	if err != cache.ErrMissed {
+		t.Fatalf("expected %v, actual %v", cache.ErrMissed, err)
+	}
+	if repo.Len() != 0 {
+		t.Fatalf("expected %v, actual %v", 0, repo.Len())
+	}
+	_, err = repo.PopLeastFrequent()
+	if err != cache.ErrNotSupported {
+		t.Fatalf("expected %v, actual %v", cache.ErrNotSupported, err)
+	}
+}
+
+func TestRemovalListener(t *testing.T) {
+	repo := repository.New(2, 0, time.Minute*5)
+	removed := []string{}
+	repo.SetRemovalListener(func(doc *cache.Document) {
+		removed = append(removed, fmt.Sprintf("%s=%v", doc.Key, doc.Value))
+	})
+
+	for i, key := range []string{"key-1", "key-2", "key-1", "key-3"} {
+		err := repo.Set(&cache.Document{Key: key, Value: i, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Delete("key-3")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+
+	// key-1 is replaced, key-2 is evicted, and key-3 is deleted
+	expected := "[key-1=0 key-2=1 key-3=3]"
+	if fmt.Sprint(removed) != expected {
+		t.Fatalf("expected %v, actual %v", expected, removed)
+	}
+}
+
+func TestEvictionListener(t *testing.T) {
+	repo := repository.New(2, 0, time.Minute*5)
+	evicted := []string{}
+	repo.SetEvictionListener(func(doc *cache.Document) {
+		evicted = append(evicted, doc.Key)
+	})
+
+	for _, key := range []string{"key-1", "key-2"} {
+		err := repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	_, err := repo.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	// The deleted item is not evicted
+	_, err = repo.Delete("key-1")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	for _, key := range []string{"key-3", "key-4"} {
+		err = repo.Set(&cache.Document{Key: key, Value: key, StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+
+	expected := "[key-2]"
+	if fmt.Sprint(evicted) != expected {
+		t.Fatalf("expected %v, actual %v", expected, evicted)
+	}
+}
+
+func TestSetMemory(t *testing.T) {
+	repo := repository.New(10, 20, time.Minute*5)
+	repo.SetMemory(internal.NewMemory(func(doc *cache.Document) (uint64, error) {
+		return uint64(len(doc.Value.(string))), nil
+	}))
+
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := repo.Set(&cache.Document{Key: key, Value: "0123456789", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	if repo.Contains("key-1") || !repo.Contains("key-2") || !repo.Contains("key-3") {
+		t.Fatalf("expected %v, actual %v", "key-1 evicted", repo.Contains("key-1"))
+	}
+
+	// The replaced item is measured by its new size
+	err := repo.Set(&cache.Document{Key: "key-3", Value: "012345678901234", StoredTime: time.Now().Unix()})
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	if repo.Contains("key-2") {
+		t.Fatalf("expected %v, actual %v", "evicted", "key-2")
+	}
+	_, err = repo.Delete("key-3")
+	if err != nil {
+		t.Fatalf("expected %v, actual %v", nil, err)
+	}
+	for _, key := range []string{"key-1", "key-2"} {
+		err = repo.Set(&cache.Document{Key: key, Value: "0123456789", StoredTime: time.Now().Unix()})
+		if err != nil {
+			t.Fatalf("expected %v, actual %v", nil, err)
+		}
+	}
+	if !repo.Contains("key-1") || !repo.Contains("key-2") {
+		t.Fatalf("expected %v, actual %v", "key-1 and key-2", "evicted")
+	}
+}
+
 func TestContains(t *testing.T) {
 	repo := repository.New(4, 500, time.Second*5)
 	arrDoc := []*cache.Document{
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// Memory tracks the size of the stored documents measured by the sizer,
+// so the max memory is checked without encoding all the documents on every write
+type Memory struct {
+	sizer func(doc *cache.Document) (size uint64, err error)
+	sizes map[string]uint64
+	total uint64
+}
+
+// NewMemory return the memory measuring the documents with the sizer
+func NewMemory(sizer func(doc *cache.Document) (size uint64, err error)) *Memory {
+	return &Memory{
+		sizer: sizer,
+		sizes: map[string]uint64{},
+	}
+}
+
+// Add measures the document, and replaces the size of the existing document with the same key
+func (m *Memory) Add(doc *cache.Document) (err error) {
+	size, err := m.sizer(doc)
+	if err != nil {
+		return
+	}
+	m.Remove(doc.Key)
+	m.sizes[doc.Key] = size
+	m.total += size
+	return
+}
+
+// Remove removes the size of the document with the key
+func (m *Memory) Remove(key string) {
+	m.total -= m.sizes[key]
+	delete(m.sizes, key)
+}
+
+// Clear removes the size of all the documents
+func (m *Memory) Clear() {
+	m.sizes = map[string]uint64{}
+	m.total = 0
+}
+
+// Total returns the total size of the documents
+func (m *Memory) Total() uint64 {
+	return m.total
+}
@@ -0,0 +1,188 @@
+package radix
+
+import (
+	"sort"
+	"strings"
+)
+
+// Tree is a radix tree (compressed trie) of the keys, used to find the keys by prefix
+// without scanning all the keys in the cache
+type Tree struct {
+	root *node
+	size int
+}
+
+type node struct {
+	prefix   string  // the label of the edge from the parent
+	leaf     bool    // whether a key ends in this node
+	children []*node // sorted by the first byte of the prefix
+}
+
+// New return an empty radix tree
+func New() *Tree {
+	return &Tree{
+		root: &node{},
+	}
+}
+
+// Insert adds the key to the tree, returns false if the key already exists
+func (t *Tree) Insert(key string) bool {
+	n := t.root
+	search := key
+	for {
+		if search == "" {
+			if n.leaf {
+				return false
+			}
+			n.leaf = true
+			t.size++
+			return true
+		}
+
+		idx, child := n.child(search[0])
+		if child == nil {
+			n.addChild(&node{prefix: search, leaf: true})
+			t.size++
+			return true
+		}
+
+		common := commonPrefix(search, child.prefix)
+		if common == len(child.prefix) {
+			search = search[common:]
+			n = child
+			continue
+		}
+
+		// Split the edge, the new node holds the common prefix
+		split := &node{
+			prefix:   search[:common],
+			children: []*node{child},
+		}
+		child.prefix = child.prefix[common:]
+		n.children[idx] = split
+		search = search[common:]
+		if search == "" {
+			split.leaf = true
+		} else {
+			split.addChild(&node{prefix: search, leaf: true})
+		}
+		t.size++
+		return true
+	}
+}
+
+// Delete removes the key from the tree, returns false if the key doesn't exist
+func (t *Tree) Delete(key string) bool {
+	var parent *node
+	parentIdx := 0
+	n := t.root
+	search := key
+	for search != "" {
+		idx, child := n.child(search[0])
+		if child == nil || !strings.HasPrefix(search, child.prefix) {
+			return false
+		}
+		parent, parentIdx = n, idx
+		n = child
+		search = search[len(child.prefix):]
+	}
+	if !n.leaf {
+		return false
+	}
+	n.leaf = false
+	t.size--
+
+	// Remove the empty node and merge the node with a single child, to keep the tree compressed
+	if parent == nil {
+		return true
+	}
+	switch len(n.children) {
+	case 0:
+		parent.children = append(parent.children[:parentIdx], parent.children[parentIdx+1:]...)
+		if parent != t.root && !parent.leaf && len(parent.children) == 1 {
+			parent.mergeChild()
+		}
+	case 1:
+		n.mergeChild()
+	}
+	return true
+}
+
+// WalkPrefix calls fn for each key with the given prefix in lexical order, until fn returns false
+func (t *Tree) WalkPrefix(prefix string, fn func(key string) bool) {
+	n := t.root
+	path := ""
+	search := prefix
+	for search != "" {
+		_, child := n.child(search[0])
+		if child == nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(search, child.prefix):
+			search = search[len(child.prefix):]
+		case strings.HasPrefix(child.prefix, search):
+			search = ""
+		default:
+			return
+		}
+		path += child.prefix
+		n = child
+	}
+	n.walk(path, fn)
+}
+
+// Len returns the number of keys in the tree
+func (t *Tree) Len() int {
+	return t.size
+}
+
+// Clear removes all the keys from the tree
+func (t *Tree) Clear() {
+	t.root = &node{}
+	t.size = 0
+}
+
+func (n *node) walk(path string, fn func(key string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(path+child.prefix, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *node) child(label byte) (int, *node) {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= label
+	})
+	if idx < len(n.children) && n.children[idx].prefix[0] == label {
+		return idx, n.children[idx]
+	}
+	return idx, nil
+}
+
+func (n *node) addChild(child *node) {
+	idx, _ := n.child(child.prefix[0])
+	n.children = append(n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = child
+}
+
+func (n *node) mergeChild() {
+	child := n.children[0]
+	n.prefix += child.prefix
+	n.leaf = child.leaf
+	n.children = child.children
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
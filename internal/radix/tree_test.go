@@ -0,0 +1,104 @@
+package radix_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bxcodec/gotcha/internal/radix"
+)
+
+func collect(tree *radix.Tree, prefix string) (keys []string) {
+	tree.WalkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return
+}
+
+func TestWalkPrefix(t *testing.T) {
+	tree := radix.New()
+	keys := []string{
+		"tenant:1:user:1", "tenant:1:user:2", "tenant:1:order:1",
+		"tenant:12:user:1", "tenant:2:user:1", "tenant", "other",
+	}
+	for _, key := range keys {
+		if !tree.Insert(key) {
+			t.Fatalf("expected %v, actual %v", true, false)
+		}
+	}
+	if tree.Insert("tenant:1:user:1") {
+		t.Fatalf("expected %v, actual %v", false, true)
+	}
+	if tree.Len() != len(keys) {
+		t.Fatalf("expected %v, actual %v", len(keys), tree.Len())
+	}
+
+	cases := map[string]string{
+		"tenant:1:":      "[tenant:1:order:1 tenant:1:user:1 tenant:1:user:2]",
+		"tenant:1":       "[tenant:12:user:1 tenant:1:order:1 tenant:1:user:1 tenant:1:user:2]",
+		"tenant:1:user:": "[tenant:1:user:1 tenant:1:user:2]",
+		"tenant:3":       "[]",
+		"tenant":         "[tenant tenant:12:user:1 tenant:1:order:1 tenant:1:user:1 tenant:1:user:2 tenant:2:user:1]",
+		"":               "[other tenant tenant:12:user:1 tenant:1:order:1 tenant:1:user:1 tenant:1:user:2 tenant:2:user:1]",
+	}
+	for prefix, expected := range cases {
+		if actual := fmt.Sprint(collect(tree, prefix)); actual != expected {
+			t.Fatalf("prefix %q expected %v, actual %v", prefix, expected, actual)
+		}
+	}
+
+	if !tree.Delete("tenant") || tree.Delete("tenant") || tree.Delete("tenant:") {
+		t.Fatalf("expected %v, actual %v", "tenant deleted once", "not")
+	}
+	if actual := fmt.Sprint(collect(tree, "tenant:2")); actual != "[tenant:2:user:1]" {
+		t.Fatalf("expected %v, actual %v", "[tenant:2:user:1]", actual)
+	}
+}
+
+func TestRandomOperations(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tree := radix.New()
+	expected := map[string]bool{}
+	randomKey := func() string {
+		return fmt.Sprintf("t:%d:u:%d", rnd.Intn(20), rnd.Intn(50))
+	}
+
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		if rnd.Intn(3) == 0 {
+			if tree.Delete(key) != expected[key] {
+				t.Fatalf("expected %v, actual %v", expected[key], !expected[key])
+			}
+			delete(expected, key)
+			continue
+		}
+		if tree.Insert(key) == expected[key] {
+			t.Fatalf("expected %v, actual %v", !expected[key], expected[key])
+		}
+		expected[key] = true
+	}
+	if tree.Len() != len(expected) {
+		t.Fatalf("expected %v, actual %v", len(expected), tree.Len())
+	}
+
+	for _, prefix := range []string{"", "t:1", "t:1:", "t:15:u:4", "t:7:u:12", "x"} {
+		var keys []string
+		for key := range expected {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		if actual := collect(tree, prefix); fmt.Sprint(actual) != fmt.Sprint(keys) {
+			t.Fatalf("prefix %q expected %v, actual %v", prefix, keys, actual)
+		}
+	}
+
+	tree.Clear()
+	if tree.Len() != 0 || len(collect(tree, "")) != 0 {
+		t.Fatalf("expected %v, actual %v", 0, tree.Len())
+	}
+}
@@ -1,14 +1,32 @@
 package internal
 
 import (
+	"time"
+
 	"github.com/bxcodec/gotcha/cache"
 )
 
 type Repository interface {
 	Set(doc *cache.Document) (err error)
+	SetWithFrequency(doc *cache.Document, frequency uint64) (err error)
+	Frequency(key string) (frequency uint64)
 	Get(key string) (res *cache.Document, err error)
+	Peek(key string) (res *cache.Document, err error)
+	// PeekMetadata returns the stored document without decoding or copying the value,
+	// so only its metadata must be used
+	PeekMetadata(key string) (res *cache.Document, err error)
+	SetTTL(key string, storedTime int64, ttl time.Duration) (err error)
 	Clear() (err error)
 	Contains(key string) (ok bool)
 	Delete(key string) (ok bool, err error)
 	Keys() (keys []string, err error)
+	KeysWithPrefix(prefix string) (keys []string)
+	PopOldest() (res *cache.Document, err error)
+	PopLeastFrequent() (res *cache.Document, err error)
+	Range(fn func(doc *cache.Document) bool)
+	// RangeMetadata is the same as Range without decoding or copying the values,
+	// so only the metadata of the documents must be used
+	RangeMetadata(fn func(doc *cache.Document) bool)
+	SetRemovalListener(fn func(doc *cache.Document))
+	SetEvictionListener(fn func(doc *cache.Document))
 }
@@ -0,0 +1,105 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal"
+)
+
+// CodecCloner copies the values by encoding and decoding them with the codec, GobCodec if nil.
+// The types other than the basic types must be registered with RegisterType
+type CodecCloner struct {
+	Codec cache.Codec
+}
+
+// Clone returns the deep copy of the value
+func (c CodecCloner) Clone(value interface{}) (interface{}, error) {
+	codec := c.Codec
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	data, err := MarshalValue(codec, value)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalValue(codec, data)
+}
+
+// isolatedRepository copies the values stored and/or returned by the repository with the cloner.
+// The popped values are not copied, since they're not in the repository anymore
+type isolatedRepository struct {
+	internal.Repository
+	cloner cache.Cloner
+	mode   cache.IsolationMode
+}
+
+// clone copies the value, except the immutable values
+func (r *isolatedRepository) clone(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return value, nil
+	case []byte:
+		return append([]byte(nil), v...), nil
+	}
+	return r.cloner.Clone(value)
+}
+
+// read returns a copy of the document with the copied value
+func (r *isolatedRepository) read(doc *cache.Document, err error) (*cache.Document, error) {
+	if err != nil || r.mode&cache.CopyOnRead == 0 {
+		return doc, err
+	}
+	value, err := r.clone(doc.Value)
+	if err != nil {
+		return nil, err
+	}
+	copied := *doc
+	copied.Value = value
+	return &copied, nil
+}
+
+func (r *isolatedRepository) Set(doc *cache.Document) (err error) {
+	if r.mode&cache.CopyOnWrite != 0 {
+		if doc.Value, err = r.clone(doc.Value); err != nil {
+			return
+		}
+	}
+	return r.Repository.Set(doc)
+}
+
+func (r *isolatedRepository) SetWithFrequency(doc *cache.Document, frequency uint64) (err error) {
+	if r.mode&cache.CopyOnWrite != 0 {
+		if doc.Value, err = r.clone(doc.Value); err != nil {
+			return
+		}
+	}
+	return r.Repository.SetWithFrequency(doc, frequency)
+}
+
+func (r *isolatedRepository) Get(key string) (res *cache.Document, err error) {
+	return r.read(r.Repository.Get(key))
+}
+
+func (r *isolatedRepository) Peek(key string) (res *cache.Document, err error) {
+	return r.read(r.Repository.Peek(key))
+}
+
+// isolateStored copies the value just stored, before it's returned to the caller with CopyOnRead.
+// Without CopyOnWrite, the value is stored as is, so returning it would share it with the cache
+func (c *Cache) isolateStored(value interface{}) (interface{}, error) {
+	repo, ok := c.repo.(*isolatedRepository)
+	if !ok || repo.mode&cache.CopyOnRead == 0 || repo.mode&cache.CopyOnWrite != 0 {
+		return value, nil
+	}
+	return repo.clone(value)
+}
+
+// Range skips the documents failing to copy
+func (r *isolatedRepository) Range(fn func(doc *cache.Document) bool) {
+	r.Repository.Range(func(doc *cache.Document) bool {
+		copied, err := r.read(doc, nil)
+		if err != nil {
+			return true
+		}
+		return fn(copied)
+	})
+}
@@ -0,0 +1,222 @@
+package gotcha_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+type isolationItem struct {
+	Name  string
+	Items []string
+}
+
+func TestIsolation(t *testing.T) {
+	gotcha.RegisterType("isolation-map", map[string]int{})
+	for name, mode := range map[string]cache.IsolationMode{
+		"copy-on-write": cache.CopyOnWrite,
+		"copy-on-read":  cache.CopyOnRead,
+		"both":          cache.CopyOnWrite | cache.CopyOnRead,
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetIsolation(mode, nil))
+			value := map[string]int{"count": 1}
+			err := c.Set("key-1", value)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			if mode&cache.CopyOnWrite != 0 {
+				// Mutating the stored value doesn't leak to the cache
+				value["count"] = 2
+				val, err := c.Get("key-1")
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if val.(map[string]int)["count"] != 1 {
+					t.Fatalf("expected: %v, got %v", 1, val)
+				}
+			}
+
+			if mode&cache.CopyOnRead != 0 {
+				// Mutating the returned value doesn't leak to the other readers
+				val, err := c.Get("key-1")
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				val.(map[string]int)["count"] = 3
+				for _, val := range c.All() {
+					if val.(map[string]int)["count"] == 3 {
+						t.Fatalf("expected: %v, got %v", "isolated", val)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNoIsolation(t *testing.T) {
+	c := gotcha.New()
+	value := map[string]int{"count": 1}
+	err := c.Set("key-1", value)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// The value is shared with the cache
+	value["count"] = 2
+	val, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val.(map[string]int)["count"] != 2 {
+		t.Fatalf("expected: %v, got %v", 2, val)
+	}
+}
+
+type itemCloner struct {
+	calls int
+}
+
+func (c *itemCloner) Clone(value interface{}) (interface{}, error) {
+	c.calls++
+	item := value.(*isolationItem)
+	return &isolationItem{Name: item.Name, Items: append([]string(nil), item.Items...)}, nil
+}
+
+func TestIsolationCloner(t *testing.T) {
+	cloner := &itemCloner{}
+	c := gotcha.New(gotcha.NewOption().SetIsolation(cache.CopyOnWrite|cache.CopyOnRead, cloner))
+	item := &isolationItem{Name: "john", Items: []string{"a"}}
+	err := c.Set("key-1", item)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	item.Items[0] = "b"
+
+	val, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	got := val.(*isolationItem)
+	if got == item || got.Items[0] != "a" {
+		t.Fatalf("expected: %v, got %v", "a", got.Items)
+	}
+	got.Items[0] = "c"
+	val, err = c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val.(*isolationItem).Items[0] != "a" {
+		t.Fatalf("expected: %v, got %v", "a", val.(*isolationItem).Items)
+	}
+	if cloner.calls != 3 {
+		t.Fatalf("expected: %v, got %v", 3, cloner.calls)
+	}
+
+	// The immutable values are not copied
+	err = c.Set("key-2", "value")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.Get("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if cloner.calls != 3 {
+		t.Fatalf("expected: %v, got %v", 3, cloner.calls)
+	}
+}
+
+func TestIsolationUnsupported(t *testing.T) {
+	// The unregistered type can't be copied by gob
+	c := gotcha.New(gotcha.NewOption().SetIsolation(cache.CopyOnWrite, nil))
+	err := c.Set("key-1", &isolationItem{Name: "john"})
+	if err == nil {
+		t.Fatalf("expected: %v, got %v", "error", err)
+	}
+	if c.Contains("key-1") {
+		t.Fatalf("expected: %v, got %v", false, true)
+	}
+}
+
+func TestIsolationStoredValue(t *testing.T) {
+	cloner := &itemCloner{}
+	c := gotcha.New(gotcha.NewOption().SetIsolation(cache.CopyOnRead, cloner))
+	loaded := &isolationItem{Name: "john", Items: []string{"a"}}
+	val, err := c.GetOrLoad(context.Background(), "key-1", func(ctx context.Context, key string) (interface{}, error) {
+		return loaded, nil
+	})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// The value is stored as is without CopyOnWrite, so a copy is returned
+	if val == loaded {
+		t.Fatalf("expected: %v, got %v", "copy", "stored value")
+	}
+
+	computed := &isolationItem{Name: "jane", Items: []string{"a"}}
+	val, err = c.ComputeIfAbsent("key-2", func(key string) (interface{}, error) {
+		return computed, nil
+	})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val == computed {
+		t.Fatalf("expected: %v, got %v", "copy", "stored value")
+	}
+	val.(*isolationItem).Items[0] = "b"
+	val, err = c.Get("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val.(*isolationItem).Items[0] != "a" {
+		t.Fatalf("expected: %v, got %v", "a", val.(*isolationItem).Items)
+	}
+}
+
+func TestIsolationMetadata(t *testing.T) {
+	cloner := &itemCloner{}
+	c := gotcha.New(gotcha.NewOption().SetIsolation(cache.CopyOnRead, cloner))
+	err := c.Set("key-1", &isolationItem{Name: "john"})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// Checking the existence, the expiry time and the version doesn't copy the value
+	if !c.Contains("key-1") {
+		t.Fatalf("expected: %v, got %v", true, false)
+	}
+	_, err = c.TTL("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Add("key-1", "value")
+	if err != cache.ErrExists {
+		t.Fatalf("expected: %v, got %v", cache.ErrExists, err)
+	}
+	// Walking the keys, the expiry times and the namespace quota doesn't copy the values either
+	var keys []string
+	for key := range c.Keys() {
+		keys = append(keys, key)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected: %v, got %v", 1, len(keys))
+	}
+	_, err = c.ExpiryStats()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	ns := c.Namespace("users")
+	ns.SetQuota(1)
+	for _, key := range []string{"key-1", "key-2"} {
+		err = ns.Set(key, &isolationItem{Name: key})
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	if cloner.calls != 0 {
+		t.Fatalf("expected: %v, got %v", 0, cloner.calls)
+	}
+}
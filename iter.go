@@ -0,0 +1,79 @@
+package gotcha
+
+import (
+	"iter"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// All returns an iterator over the non expired items, the items in the disk tier first in the order they're spilled.
+// For LRU the items are ordered from the oldest to the newest,
+// and for LFU from the least frequently used, the oldest first within the same frequency.
+// The iteration doesn't update the recent-ness or the frequency of the items.
+// See cache.IterationMode for how the concurrent mutation is handled
+func (c *Cache) All() iter.Seq2[string, interface{}] {
+	return func(yield func(string, interface{}) bool) {
+		c.iterate(false, func(doc *cache.Document) bool {
+			return yield(doc.Key, doc.Value)
+		})
+	}
+}
+
+// Keys returns an iterator over the keys of the non expired items, with the same order as All.
+// The values are not read
+func (c *Cache) Keys() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		c.iterate(true, func(doc *cache.Document) bool {
+			return yield(doc.Key)
+		})
+	}
+}
+
+// iterate calls fn for each non expired document according to the iteration mode, the documents in the disk tier first.
+// With metadata the values are not decoded or copied, so only the metadata must be used.
+// With LiveIteration fn is called under the read lock, so it must not call the cache
+func (c *Cache) iterate(metadata bool, fn func(doc *cache.Document) bool) {
+	rangeSpilled, rangeMemory := c.rangeSpilled, c.repo.Range
+	if metadata {
+		rangeSpilled, rangeMemory = c.rangeSpilledMetadata, c.repo.RangeMetadata
+	}
+	if c.option.IterationMode == cache.LiveIteration {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+		done := false
+		rangeSpilled(func(doc *cache.Document) bool {
+			done = !fn(doc)
+			return !done
+		})
+		if done {
+			return
+		}
+		rangeMemory(func(doc *cache.Document) bool {
+			if doc.IsExpired() {
+				return true
+			}
+			return fn(doc)
+		})
+		return
+	}
+
+	var docs []cache.Document
+	c.mutex.RLock()
+	rangeSpilled(func(doc *cache.Document) bool {
+		docs = append(docs, *doc)
+		return true
+	})
+	rangeMemory(func(doc *cache.Document) bool {
+		if !doc.IsExpired() {
+			docs = append(docs, *doc)
+		}
+		return true
+	})
+	c.mutex.RUnlock()
+
+	for i := range docs {
+		if !fn(&docs[i]) {
+			return
+		}
+	}
+}
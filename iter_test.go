@@ -0,0 +1,142 @@
+package gotcha_test
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestIteratorOrder(t *testing.T) {
+	setItems := func(c cache.Cache) {
+		for _, key := range []string{"key-1", "key-2", "key-3", "key-4"} {
+			err := c.Set(key, "value-"+key)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		for _, key := range []string{"key-2", "key-1", "key-2"} {
+			_, err := c.Get(key)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		// The expired item is skipped
+		err := c.Touch("key-4", time.Nanosecond)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	cases := []struct {
+		algorithm string
+		mode      cache.IterationMode
+		expected  []string
+	}{
+		{cache.LRUAlgorithm, cache.SnapshotIteration, []string{"key-3", "key-1", "key-2"}},
+		{cache.LRUAlgorithm, cache.LiveIteration, []string{"key-3", "key-1", "key-2"}},
+		{cache.LFUAlgorithm, cache.SnapshotIteration, []string{"key-3", "key-1", "key-2"}},
+		{cache.LFUAlgorithm, cache.LiveIteration, []string{"key-3", "key-1", "key-2"}},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s-%d", tc.algorithm, tc.mode), func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(tc.algorithm).SetIterationMode(tc.mode))
+			setItems(c)
+
+			keys := slices.Collect(c.Keys())
+			if !slices.Equal(keys, tc.expected) {
+				t.Fatalf("expected: %v, got %v", tc.expected, keys)
+			}
+
+			keys = keys[:0]
+			for key, val := range c.All() {
+				if val != "value-"+key {
+					t.Fatalf("expected: %v, got %v", "value-"+key, val)
+				}
+				keys = append(keys, key)
+			}
+			if !slices.Equal(keys, tc.expected) {
+				t.Fatalf("expected: %v, got %v", tc.expected, keys)
+			}
+
+			// Iterating doesn't change the order
+			keys = slices.Collect(c.Keys())
+			if !slices.Equal(keys, tc.expected) {
+				t.Fatalf("expected: %v, got %v", tc.expected, keys)
+			}
+
+			for key := range c.Keys() {
+				if key != tc.expected[0] {
+					t.Fatalf("expected: %v, got %v", tc.expected[0], key)
+				}
+				break
+			}
+		})
+	}
+}
+
+func TestSnapshotIterationWithWrite(t *testing.T) {
+	c := gotcha.New()
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// The snapshot allows the loop body to write to the cache
+	for key := range c.Keys() {
+		err := c.Delete(key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	keys, err := c.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected: %v, got %v", 0, len(keys))
+	}
+}
+
+func TestIterationConcurrent(t *testing.T) {
+	for _, mode := range []cache.IterationMode{cache.SnapshotIteration, cache.LiveIteration} {
+		t.Run(fmt.Sprint(mode), func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetIterationMode(mode).SetMaxSizeItem(100))
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						key := fmt.Sprintf("key-%d-%d", i, j)
+						if err := c.Set(key, j); err != nil {
+							t.Errorf("expected: %v, got %v", nil, err)
+						}
+						if j%2 == 0 {
+							if err := c.Delete(key); err != nil {
+								t.Errorf("expected: %v, got %v", nil, err)
+							}
+						}
+					}
+				}(i)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 20; j++ {
+						for key, val := range c.All() {
+							if key == "" || val == nil {
+								t.Errorf("expected: %v, got %v", "item", key)
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
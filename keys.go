@@ -0,0 +1,74 @@
+package gotcha
+
+import (
+	"path"
+	"strings"
+)
+
+// KeysMatching will return the keys of the non expired items matching the glob pattern,
+// the pattern syntax is the same as path.Match, e.g "tenant:*:user:1"
+func (c *Cache) KeysMatching(pattern string) (keys []string, err error) {
+	if _, err = path.Match(pattern, ""); err != nil {
+		return
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, key := range c.keysWithPrefix(literalPrefix(pattern)) {
+		if matched, _ := path.Match(pattern, key); !matched {
+			continue
+		}
+		if _, errPeek := c.peekMetadata(key); errPeek == nil {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// DeleteByPrefix will remove all the items with the given prefix, and return the number of removed items
+func (c *Cache) DeleteByPrefix(prefix string) (deleted int, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.deleteKeys(c.keysWithPrefix(prefix))
+}
+
+// DeleteMatching will remove all the items matching the glob pattern, and return the number of removed items.
+// The pattern syntax is the same as path.Match
+func (c *Cache) DeleteMatching(pattern string) (deleted int, err error) {
+	if _, err = path.Match(pattern, ""); err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var keys []string
+	for _, key := range c.keysWithPrefix(literalPrefix(pattern)) {
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	return c.deleteKeys(keys)
+}
+
+// deleteKeys removes the given keys, the caller must hold the lock
+func (c *Cache) deleteKeys(keys []string) (deleted int, err error) {
+	for _, key := range keys {
+		ok, err := c.remove(key)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted++
+		}
+	}
+	return
+}
+
+// literalPrefix returns the prefix of the pattern before the first special character,
+// every key matching the pattern has this prefix
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
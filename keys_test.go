@@ -0,0 +1,101 @@
+package gotcha_test
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestKeyPatterns(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		for _, index := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s-index-%v", algorithm, index), func(t *testing.T) {
+				c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetKeyIndex(index).SetMaxSizeItem(6))
+				for _, key := range []string{
+					"evicted:1", "tenant:1:user:1", "tenant:1:user:2", "tenant:1:order:1", "tenant:12:user:1", "tenant:2:user:1",
+				} {
+					err := c.Set(key, key)
+					if err != nil {
+						t.Fatalf("expected: %v, got %v", nil, err)
+					}
+				}
+				// The max size is reached, so evicted:1 is removed from the index too
+				err := c.Set("other", "other")
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+
+				keysMatching := func(pattern string) string {
+					keys, err := c.KeysMatching(pattern)
+					if err != nil {
+						t.Fatalf("expected: %v, got %v", nil, err)
+					}
+					sort.Strings(keys)
+					return fmt.Sprint(keys)
+				}
+				cases := map[string]string{
+					"tenant:1:*":      "[tenant:1:order:1 tenant:1:user:1 tenant:1:user:2]",
+					"tenant:*:user:1": "[tenant:12:user:1 tenant:1:user:1 tenant:2:user:1]",
+					"tenant:?:user:1": "[tenant:1:user:1 tenant:2:user:1]",
+					"evicted:*":       "[]",
+					"other":           "[other]",
+				}
+				for pattern, expected := range cases {
+					if actual := keysMatching(pattern); actual != expected {
+						t.Fatalf("pattern %q expected: %v, got %v", pattern, expected, actual)
+					}
+				}
+
+				deleted, err := c.DeleteByPrefix("tenant:1:")
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if deleted != 3 {
+					t.Fatalf("expected: %v, got %v", 3, deleted)
+				}
+				if actual := keysMatching("tenant:*"); actual != "[tenant:12:user:1 tenant:2:user:1]" {
+					t.Fatalf("expected: %v, got %v", "[tenant:12:user:1 tenant:2:user:1]", actual)
+				}
+
+				deleted, err = c.DeleteMatching("tenant:*:user:1")
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if deleted != 2 {
+					t.Fatalf("expected: %v, got %v", 2, deleted)
+				}
+				keys, err := c.GetKeys()
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if fmt.Sprint(keys) != "[other]" {
+					t.Fatalf("expected: %v, got %v", "[other]", keys)
+				}
+
+				err = c.ClearCache()
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+				if actual := keysMatching("*"); actual != "[]" {
+					t.Fatalf("expected: %v, got %v", "[]", actual)
+				}
+			})
+		}
+	}
+}
+
+func TestKeyPatternsBadPattern(t *testing.T) {
+	c := gotcha.New()
+	_, err := c.KeysMatching("tenant:[")
+	if err != path.ErrBadPattern {
+		t.Fatalf("expected: %v, got %v", path.ErrBadPattern, err)
+	}
+	_, err = c.DeleteMatching("tenant:[")
+	if err != path.ErrBadPattern {
+		t.Fatalf("expected: %v, got %v", path.ErrBadPattern, err)
+	}
+}
@@ -0,0 +1,155 @@
+package gotcha
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// GetManyOrLoad will retrieve the items from cache, and load all the missing or early expired items
+// with a single call of the loader. The loaded items are stored to the cache.
+// The keys that are neither in the cache nor returned by the loader are not in values
+func (c *Cache) GetManyOrLoad(ctx context.Context, keys []string, loader cache.BatchLoaderFunc) (
+	values map[string]interface{}, err error) {
+	values, missing := c.GetMany(keys)
+	if len(missing) == 0 {
+		return
+	}
+
+	start := time.Now()
+	loaded, err := loader(ctx, missing)
+	if err != nil {
+		return values, err
+	}
+	delta := time.Since(start)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	failed := map[string]error{}
+	for _, key := range missing {
+		value, ok := loaded[key]
+		if !ok {
+			continue
+		}
+		document := c.newDocument(key, value)
+		document.Delta = delta
+		if errSet := c.store(document); errSet != nil {
+			values[key] = value
+			failed[key] = errSet
+			continue
+		}
+		if values[key], err = c.isolateStored(value); err != nil {
+			return
+		}
+	}
+	if len(failed) > 0 {
+		err = &cache.BatchError{Errors: failed}
+	}
+	return
+}
+
+// Dispatcher coalesces the keys loaded individually within a short time window,
+// and loads them with a single call of the batch loader.
+// Use Load as the loader of GetOrLoad, so the concurrent cache misses are loaded at once:
+//
+//	dispatcher := gotcha.NewDispatcher(batchLoader, time.Millisecond, 100)
+//	val, err := c.GetOrLoad(ctx, key, dispatcher.Load)
+type Dispatcher struct {
+	loader   cache.BatchLoaderFunc
+	wait     time.Duration
+	maxBatch int
+	mutex    *sync.Mutex
+	batch    *loaderBatch
+}
+
+type loaderBatch struct {
+	ctx    context.Context
+	keys   []string
+	seen   map[string]bool
+	once   *sync.Once
+	done   chan struct{}
+	values map[string]interface{}
+	err    error
+}
+
+// NewDispatcher return the dispatcher that loads the keys collected within the wait duration,
+// or as soon as maxBatch keys are collected. Zero values will use the default ones
+func NewDispatcher(loader cache.BatchLoaderFunc, wait time.Duration, maxBatch int) *Dispatcher {
+	if wait == 0 {
+		wait = cache.DefaultBatchWait
+	}
+	if maxBatch == 0 {
+		maxBatch = cache.DefaultMaxBatch
+	}
+	return &Dispatcher{
+		loader:   loader,
+		wait:     wait,
+		maxBatch: maxBatch,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// Load will add the key to the current batch and wait until the batch is loaded, or ctx is done.
+// The batch is loaded with the values of the context of the first key in the batch, but not canceled with it,
+// since the other keys in the batch are still waiting.
+// It returns cache.ErrMissed if the key is not returned by the batch loader
+func (d *Dispatcher) Load(ctx context.Context, key string) (value interface{}, err error) {
+	d.mutex.Lock()
+	batch := d.batch
+	if batch == nil {
+		batch = &loaderBatch{
+			ctx:  context.WithoutCancel(ctx),
+			seen: map[string]bool{},
+			once: &sync.Once{},
+			done: make(chan struct{}),
+		}
+		d.batch = batch
+		time.AfterFunc(d.wait, func() {
+			d.dispatch(batch)
+		})
+	}
+	if !batch.seen[key] {
+		batch.seen[key] = true
+		batch.keys = append(batch.keys, key)
+	}
+	full := len(batch.keys) >= d.maxBatch
+	if full {
+		// Start a new batch for the next keys
+		d.batch = nil
+	}
+	d.mutex.Unlock()
+
+	if full {
+		go d.dispatch(batch)
+	}
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	value, ok := batch.values[key]
+	if !ok {
+		return nil, cache.ErrMissed
+	}
+	return value, nil
+}
+
+// dispatch will load the batch once, either when the wait duration passed or the batch is full
+func (d *Dispatcher) dispatch(batch *loaderBatch) {
+	batch.once.Do(func() {
+		d.mutex.Lock()
+		if d.batch == batch {
+			d.batch = nil
+		}
+		d.mutex.Unlock()
+
+		batch.values, batch.err = d.loader(batch.ctx, batch.keys)
+		close(batch.done)
+	})
+}
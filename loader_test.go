@@ -0,0 +1,208 @@
+package gotcha_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+type batchLoaderMock struct {
+	mutex *sync.Mutex
+	calls [][]string
+}
+
+func newBatchLoaderMock() *batchLoaderMock {
+	return &batchLoaderMock{mutex: &sync.Mutex{}}
+}
+
+// load returns the value of every key except the "missing-*" keys
+func (m *batchLoaderMock) load(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	m.mutex.Lock()
+	m.calls = append(m.calls, keys)
+	m.mutex.Unlock()
+
+	values := map[string]interface{}{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, "missing-") {
+			continue
+		}
+		values[key] = "value-" + key
+	}
+	return values, nil
+}
+
+func TestGetManyOrLoad(t *testing.T) {
+	c := gotcha.New()
+	err := c.SetMany(map[string]interface{}{"key-1": "cached-1", "key-2": "cached-2"})
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	mock := newBatchLoaderMock()
+	values, err := c.GetManyOrLoad(context.Background(), []string{"key-1", "key-2", "key-3", "key-4", "missing-1"}, mock.load)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(mock.calls) != 1 || fmt.Sprint(mock.calls[0]) != "[key-3 key-4 missing-1]" {
+		t.Fatalf("expected: %v, got %v", "[[key-3 key-4 missing-1]]", mock.calls)
+	}
+	expected := map[string]interface{}{
+		"key-1": "cached-1",
+		"key-2": "cached-2",
+		"key-3": "value-key-3",
+		"key-4": "value-key-4",
+	}
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Fatalf("expected: %v, got %v", expected, values)
+	}
+
+	// The loaded items are stored, so only the missing one is loaded again
+	_, err = c.GetManyOrLoad(context.Background(), []string{"key-3", "key-4", "missing-1"}, mock.load)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(mock.calls) != 2 || fmt.Sprint(mock.calls[1]) != "[missing-1]" {
+		t.Fatalf("expected: %v, got %v", "[missing-1]", mock.calls)
+	}
+
+	errLoader := errors.New("loader error")
+	values, err = c.GetManyOrLoad(context.Background(), []string{"key-1", "key-5"},
+		func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			return nil, errLoader
+		})
+	if err != errLoader {
+		t.Fatalf("expected: %v, got %v", errLoader, err)
+	}
+	if len(values) != 1 || values["key-1"] != "cached-1" {
+		t.Fatalf("expected: %v, got %v", "only key-1", values)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	loadConcurrently := func(c cache.Cache, d *gotcha.Dispatcher, keys []string) map[string]error {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		errs := map[string]error{}
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				val, err := c.GetOrLoad(context.Background(), key, d.Load)
+				mutex.Lock()
+				errs[key] = err
+				mutex.Unlock()
+				if err == nil && val != "value-"+key {
+					t.Errorf("expected: %v, got %v", "value-"+key, val)
+				}
+			}(key)
+		}
+		wg.Wait()
+		return errs
+	}
+
+	t.Run("coalesce", func(t *testing.T) {
+		c := gotcha.New()
+		mock := newBatchLoaderMock()
+		d := gotcha.NewDispatcher(mock.load, time.Millisecond*50, 100)
+		keys := []string{"key-1", "key-2", "key-3", "key-4", "missing-1"}
+		errs := loadConcurrently(c, d, keys)
+		if len(mock.calls) != 1 {
+			t.Fatalf("expected: %v, got %v", 1, len(mock.calls))
+		}
+		loadedKeys := mock.calls[0]
+		sort.Strings(loadedKeys)
+		if fmt.Sprint(loadedKeys) != fmt.Sprint(keys) {
+			t.Fatalf("expected: %v, got %v", keys, loadedKeys)
+		}
+		if errs["missing-1"] != cache.ErrMissed || errs["key-1"] != nil {
+			t.Fatalf("expected: %v, got %v", "only missing-1 failed", errs)
+		}
+
+		// The loaded items are stored through the cache
+		values, missing := c.GetMany(keys)
+		if len(values) != 4 || fmt.Sprint(missing) != "[missing-1]" {
+			t.Fatalf("expected: %v, got %v %v", "4 items stored", values, missing)
+		}
+	})
+
+	t.Run("max-batch", func(t *testing.T) {
+		c := gotcha.New()
+		mock := newBatchLoaderMock()
+		d := gotcha.NewDispatcher(mock.load, time.Millisecond*50, 5)
+		keys := []string{}
+		for i := 0; i < 20; i++ {
+			keys = append(keys, fmt.Sprintf("key-%d", i))
+		}
+		errs := loadConcurrently(c, d, keys)
+		for key, err := range errs {
+			if err != nil {
+				t.Fatalf("expected: %v, got %v: %v", nil, key, err)
+			}
+		}
+		if len(mock.calls) < 4 {
+			t.Fatalf("expected: %v, got %v", "at least 4 batches", len(mock.calls))
+		}
+		for _, call := range mock.calls {
+			if len(call) > 5 {
+				t.Fatalf("expected: %v, got %v", "at most 5 keys", len(call))
+			}
+		}
+	})
+
+	t.Run("context-canceled", func(t *testing.T) {
+		mock := newBatchLoaderMock()
+		d := gotcha.NewDispatcher(mock.load, time.Second, 100)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := d.Load(ctx, "key-1")
+		if err != context.Canceled {
+			t.Fatalf("expected: %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("first-caller-canceled", func(t *testing.T) {
+		loaded := make(chan error, 1)
+		d := gotcha.NewDispatcher(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+			loaded <- ctx.Err()
+			return map[string]interface{}{"key-1": "value-1", "key-2": "value-2"}, nil
+		}, time.Millisecond*50, 100)
+
+		// The first caller cancels before the batch is loaded, the second caller still gets its value
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+		go func() {
+			_, err := d.Load(ctx, "key-1")
+			first <- err
+		}()
+		time.Sleep(time.Millisecond * 10)
+		second := make(chan interface{}, 1)
+		go func() {
+			val, err := d.Load(context.Background(), "key-2")
+			if err != nil {
+				second <- err
+				return
+			}
+			second <- val
+		}()
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+
+		if err := <-first; err != context.Canceled {
+			t.Fatalf("expected: %v, got %v", context.Canceled, err)
+		}
+		if val := <-second; val != "value-2" {
+			t.Fatalf("expected: %v, got %v", "value-2", val)
+		}
+		if err := <-loaded; err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	})
+}
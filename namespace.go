@@ -0,0 +1,161 @@
+package gotcha
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// namespace is the view over the cache for the keys prefixed with the namespace name
+type namespace struct {
+	// keep the counters first for the 64-bit alignment
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	quota     uint64 // maximum items of the namespace, zero means only limited by the cache
+
+	cache  *Cache
+	name   string
+	prefix string
+}
+
+// namespaceEscaper escapes the separator in the namespace name, so the prefix of a namespace is never
+// the prefix of the keys of another namespace, e.g "a:" and "a\:b:" for the namespaces "a" and "a:b"
+var namespaceEscaper = strings.NewReplacer(`\`, `\\`, cache.NamespaceSeparator, `\`+cache.NamespaceSeparator)
+
+// Namespace will return the view over the cache that prefixes the keys with name + cache.NamespaceSeparator.
+// The separator and the backslash in the name are escaped with a backslash.
+// The namespaces share the capacity of the cache, and calling it again with the same name returns
+// the view with the same stats and quota. The prefixed keys are still visible from the cache itself
+func (c *Cache) Namespace(name string) cache.Namespace {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ns, ok := c.namespaces[name]
+	if !ok {
+		ns = &namespace{
+			cache:  c,
+			name:   name,
+			prefix: namespaceEscaper.Replace(name) + cache.NamespaceSeparator,
+		}
+		c.namespaces[name] = ns
+	}
+	return ns
+}
+
+// Name will return the name of the namespace
+func (n *namespace) Name() string {
+	return n.name
+}
+
+// SetQuota will limit the items stored in the namespace, the least recently used for LRU
+// or the least frequently used for LFU item of the namespace is evicted when the quota reached.
+// Enforcing the quota scans the keys of the namespace on every new key, set the KeyIndex option
+// to avoid scanning all the keys of the cache. Zero quota means only limited by the cache
+func (n *namespace) SetQuota(maxSizeItem uint64) {
+	atomic.StoreUint64(&n.quota, maxSizeItem)
+}
+
+// Set used for setting the item to the namespace
+func (n *namespace) Set(key string, value interface{}) (err error) {
+	c := n.cache
+	document := c.newDocument(n.prefix+key, value)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.repo.Contains(document.Key) {
+		n.evict()
+	}
+	err = c.store(document)
+	return
+}
+
+// evict removes the items of the namespace in the eviction order until there is a room for a new item.
+// The caller must hold the lock
+func (n *namespace) evict() {
+	quota := atomic.LoadUint64(&n.quota)
+	if quota == 0 {
+		return
+	}
+	c := n.cache
+	// The quota limits the items in the memory, the items spilled to the disk tier are not counted
+	total := uint64(len(c.repo.KeysWithPrefix(n.prefix)))
+	if total < quota {
+		return
+	}
+
+	victims := make([]string, 0, total-quota+1)
+	c.repo.RangeMetadata(func(doc *cache.Document) bool {
+		if strings.HasPrefix(doc.Key, n.prefix) {
+			victims = append(victims, doc.Key)
+		}
+		return uint64(len(victims)) < total-quota+1
+	})
+	deleted, _ := c.deleteKeys(victims)
+	atomic.AddUint64(&n.evictions, uint64(deleted))
+}
+
+// Get will retrieve the item from the namespace
+func (n *namespace) Get(key string) (value interface{}, err error) {
+	value, err = n.cache.Get(n.prefix + key)
+	if err == cache.ErrMissed {
+		atomic.AddUint64(&n.misses, 1)
+		return
+	}
+	if err == nil {
+		atomic.AddUint64(&n.hits, 1)
+	}
+	return
+}
+
+// Peek will retrieve the item from the namespace without updating the recent-ness or the frequency of the item
+func (n *namespace) Peek(key string) (value interface{}, err error) {
+	return n.cache.Peek(n.prefix + key)
+}
+
+// Contains checks if the item exists in the namespace and not expired
+func (n *namespace) Contains(key string) (ok bool) {
+	return n.cache.Contains(n.prefix + key)
+}
+
+// Delete will remove the item from the namespace
+func (n *namespace) Delete(key string) (err error) {
+	return n.cache.Delete(n.prefix + key)
+}
+
+// GetKeys will retrieve the keys of the non expired items of the namespace, without the namespace prefix
+func (n *namespace) GetKeys() (keys []string, err error) {
+	c := n.cache
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	prefixed := c.keysWithPrefix(n.prefix)
+	keys = make([]string, 0, len(prefixed))
+	for _, key := range prefixed {
+		if _, errPeek := c.peekMetadata(key); errPeek == nil {
+			keys = append(keys, strings.TrimPrefix(key, n.prefix))
+		}
+	}
+	return
+}
+
+// ClearCache will remove all the items of the namespace, the other namespaces are kept
+func (n *namespace) ClearCache() (err error) {
+	_, err = n.cache.DeleteByPrefix(n.prefix)
+	return
+}
+
+// Stats will return the stats of the namespace
+func (n *namespace) Stats() (stats cache.NamespaceStats, err error) {
+	c := n.cache
+	c.mutex.RLock()
+	for _, key := range c.keysWithPrefix(n.prefix) {
+		if _, errPeek := c.peekMetadata(key); errPeek == nil {
+			stats.Items++
+		}
+	}
+	c.mutex.RUnlock()
+
+	stats.Hits = atomic.LoadUint64(&n.hits)
+	stats.Misses = atomic.LoadUint64(&n.misses)
+	stats.Evictions = atomic.LoadUint64(&n.evictions)
+	return
+}
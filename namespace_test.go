@@ -0,0 +1,222 @@
+package gotcha_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestNamespace(t *testing.T) {
+	c := gotcha.New()
+	users := c.Namespace("users")
+	orders := c.Namespace("orders")
+
+	err := users.Set("1", "john")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = orders.Set("1", "order-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	val, err := users.Get("1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "john" {
+		t.Fatalf("expected: %v, got %v", "john", val)
+	}
+	val, err = orders.Get("1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "order-1" {
+		t.Fatalf("expected: %v, got %v", "order-1", val)
+	}
+
+	// The keys are prefixed in the underlying cache
+	val, err = c.Get("users:1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "john" {
+		t.Fatalf("expected: %v, got %v", "john", val)
+	}
+	keys, err := users.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"1"}) {
+		t.Fatalf("expected: %v, got %v", []string{"1"}, keys)
+	}
+
+	// Clearing the namespace keeps the other namespaces
+	err = users.ClearCache()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if users.Contains("1") {
+		t.Fatalf("expected: %v, got %v", "cleared", "users:1")
+	}
+	if !orders.Contains("1") {
+		t.Fatalf("expected: %v, got %v", "orders:1", "cleared")
+	}
+}
+
+func TestNamespaceStats(t *testing.T) {
+	c := gotcha.New()
+	users := c.Namespace("users")
+	for i := 0; i < 3; i++ {
+		err := users.Set(fmt.Sprintf("%d", i), i)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	_, _ = users.Get("0")
+	_, _ = users.Get("1")
+	_, _ = users.Get("missing")
+	_ = c.Namespace("orders").Set("0", 0)
+
+	// The same name returns the view with the same stats
+	stats, err := c.Namespace("users").Stats()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	expected := cache.NamespaceStats{Items: 3, Hits: 2, Misses: 1}
+	if stats != expected {
+		t.Fatalf("expected: %+v, got %+v", expected, stats)
+	}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(10))
+			users := c.Namespace("users")
+			users.SetQuota(2)
+			err := c.Set("other", "other")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			for _, key := range []string{"1", "2"} {
+				err = users.Set(key, key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			// Access users:1, so users:2 is the one evicted by the quota
+			_, err = users.Get("1")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			err = users.Set("3", "3")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			keys, err := users.GetKeys()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, []string{"1", "3"}) {
+				t.Fatalf("expected: %v, got %v", []string{"1", "3"}, keys)
+			}
+			// The items outside the namespace are not evicted by the quota
+			if !c.Contains("other") {
+				t.Fatalf("expected: %v, got %v", "other", "evicted")
+			}
+			stats, err := users.Stats()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if stats.Evictions != 1 {
+				t.Fatalf("expected: %v, got %v", 1, stats.Evictions)
+			}
+		})
+	}
+}
+
+func TestNamespaceSharedCapacity(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(2))
+	err := c.Namespace("users").Set("1", 1)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Namespace("orders").Set("1", 1)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Namespace("products").Set("1", 1)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The least recently used item of all namespaces is evicted
+	if c.Namespace("users").Contains("1") {
+		t.Fatalf("expected: %v, got %v", "evicted", "users:1")
+	}
+	keys, err := c.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected: %v, got %v", 2, len(keys))
+	}
+}
+
+func TestNamespaceSeparatorInName(t *testing.T) {
+	c := gotcha.New()
+	err := c.Namespace("a").Set("b:x", "a")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Namespace("a:b").Set("x", "a:b")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The separator in the name is escaped, so the keys of the namespaces don't collide
+	value, err := c.Namespace("a").Get("b:x")
+	if err != nil || value != "a" {
+		t.Fatalf("expected: %v, got %v", "a", value)
+	}
+	err = c.Namespace("a").ClearCache()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	value, err = c.Namespace("a:b").Get("x")
+	if err != nil || value != "a:b" {
+		t.Fatalf("expected: %v, got %v", "a:b", value)
+	}
+}
+
+func TestNamespaceGetKeysExpired(t *testing.T) {
+	c := gotcha.New()
+	users := c.Namespace("users")
+	for _, key := range []string{"1", "2"} {
+		err := users.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	err := c.Touch("users:1", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	keys, err := users.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if !reflect.DeepEqual(keys, []string{"2"}) {
+		t.Fatalf("expected: %v, got %v", []string{"2"}, keys)
+	}
+}
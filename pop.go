@@ -0,0 +1,68 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// Peek will retrieve the item from cache without updating the recent-ness or the frequency of the item
+func (c *Cache) Peek(key string) (value interface{}, err error) {
+	c.mutex.RLock()
+	doc, err := c.peek(key)
+	c.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+	value = doc.Value
+	return
+}
+
+// Contains checks if the item exists and not expired, without updating the recent-ness or the frequency
+func (c *Cache) Contains(key string) (ok bool) {
+	c.mutex.RLock()
+	_, err := c.peekMetadata(key)
+	c.mutex.RUnlock()
+	return err == nil
+}
+
+// GetAndDelete will atomically retrieve and remove the item from cache
+func (c *Cache) GetAndDelete(key string) (value interface{}, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	doc, err := c.peek(key)
+	if err != nil {
+		return
+	}
+	_, err = c.remove(key)
+	if err != nil {
+		return
+	}
+	value = doc.Value
+	return
+}
+
+// PopOldest will remove and return the oldest item. For LRU it's the least recently used item,
+// and for LFU it's the item with the oldest stored time.
+// The expired items are removed along the way, cache.ErrMissed is returned if the cache is empty
+func (c *Cache) PopOldest() (key string, value interface{}, err error) {
+	return c.pop(c.repo.PopOldest)
+}
+
+// PopLeastFrequent will remove and return the oldest item from the least frequently used items.
+// It returns cache.ErrNotSupported for LRU, and cache.ErrMissed if the cache is empty
+func (c *Cache) PopLeastFrequent() (key string, value interface{}, err error) {
+	return c.pop(c.repo.PopLeastFrequent)
+}
+
+func (c *Cache) pop(popFn func() (*cache.Document, error)) (key string, value interface{}, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for {
+		doc, err := popFn()
+		if err != nil {
+			return "", nil, err
+		}
+		if !doc.IsExpired() {
+			return doc.Key, doc.Value, nil
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package gotcha_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestPeekAndContains(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(2))
+			for _, key := range []string{"key-1", "key-2"} {
+				err := c.Set(key, key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			_, err := c.Get("key-2")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			// Peek doesn't change the recent-ness or the frequency, so key-1 is still evicted
+			val, err := c.Peek("key-1")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "key-1" {
+				t.Fatalf("expected: %v, got %v", "key-1", val)
+			}
+			if !c.Contains("key-1") {
+				t.Fatalf("expected: %v, got %v", true, false)
+			}
+			err = c.Set("key-3", "key-3")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if c.Contains("key-1") {
+				t.Fatalf("expected: %v, got %v", false, true)
+			}
+			_, err = c.Peek("key-1")
+			if err != cache.ErrMissed {
+				t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+			}
+
+			// The expired item doesn't exist
+			err = c.Touch("key-3", time.Nanosecond)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if c.Contains("key-3") {
+				t.Fatalf("expected: %v, got %v", false, true)
+			}
+		})
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	c := gotcha.New()
+	err := c.Set("name", "John Snow")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.GetAndDelete("name")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "John Snow" {
+		t.Fatalf("expected: %v, got %v", "John Snow", val)
+	}
+	_, err = c.GetAndDelete("name")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestPop(t *testing.T) {
+	setItems := func(c cache.Cache) {
+		for _, key := range []string{"key-1", "key-2", "key-3", "key-4"} {
+			err := c.Set(key, key)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		// key-2 is expired, and key-1 is used
+		err := c.Touch("key-2", time.Nanosecond)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		_, err = c.Get("key-1")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	popAll := func(pop func() (string, interface{}, error)) (keys []string) {
+		for {
+			key, val, err := pop()
+			if err == cache.ErrMissed {
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != key {
+				t.Fatalf("expected: %v, got %v", key, val)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	t.Run("lru-pop-oldest", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetAlgorithm(cache.LRUAlgorithm))
+		setItems(c)
+		keys := popAll(c.PopOldest)
+		if len(keys) != 3 || keys[0] != "key-3" || keys[1] != "key-4" || keys[2] != "key-1" {
+			t.Fatalf("expected: %v, got %v", "[key-3 key-4 key-1]", keys)
+		}
+		_, _, err := c.PopLeastFrequent()
+		if err != cache.ErrNotSupported {
+			t.Fatalf("expected: %v, got %v", cache.ErrNotSupported, err)
+		}
+	})
+
+	t.Run("lfu-pop-least-frequent", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetAlgorithm(cache.LFUAlgorithm))
+		setItems(c)
+		keys := popAll(c.PopLeastFrequent)
+		if len(keys) != 3 || keys[0] != "key-3" || keys[1] != "key-4" || keys[2] != "key-1" {
+			t.Fatalf("expected: %v, got %v", "[key-3 key-4 key-1]", keys)
+		}
+	})
+
+	t.Run("lfu-pop-oldest", func(t *testing.T) {
+		c := gotcha.New(gotcha.NewOption().SetAlgorithm(cache.LFUAlgorithm))
+		setItems(c)
+		keys := popAll(c.PopOldest)
+		if len(keys) != 3 {
+			t.Fatalf("expected: %v, got %v", 3, len(keys))
+		}
+	})
+}
@@ -62,9 +62,9 @@ git push origin ${TAG}
 
 for dir in $PACKAGE_DIRS
 do
-    printf "${dir}: go get -u && go mod tidy -compat=1.19\n"
+    printf "${dir}: go get -u && go mod tidy -compat=1.23\n"
     go get github.com/bxcodec/gotcha@${TAG}
-    (cd ./${dir} && go get -u && go mod tidy) # -compat=1.19
+    (cd ./${dir} && go get -u && go mod tidy) # -compat=1.23
 done
 
 git push --set-upstream origin release/${TAG}
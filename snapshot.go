@@ -0,0 +1,186 @@
+package gotcha
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// snapshotVersion is the version of the snapshot format, increased on every incompatible change
+const snapshotVersion = 1
+
+// GobSnapshotCodec encodes the snapshot with encoding/gob. The concrete types of the values
+// other than the basic types must be registered with gob.Register
+type GobSnapshotCodec struct{}
+
+// NewEncoder return the gob encoder writing to w
+func (GobSnapshotCodec) NewEncoder(w io.Writer) cache.Encoder {
+	return gob.NewEncoder(w)
+}
+
+// NewDecoder return the gob decoder reading from r
+func (GobSnapshotCodec) NewDecoder(r io.Reader) cache.Decoder {
+	return gob.NewDecoder(r)
+}
+
+// JSONSnapshotCodec encodes the snapshot with encoding/json. The values are restored
+// as the JSON types, e.g the numbers are restored as float64
+type JSONSnapshotCodec struct{}
+
+// NewEncoder return the JSON encoder writing to w
+func (JSONSnapshotCodec) NewEncoder(w io.Writer) cache.Encoder {
+	return json.NewEncoder(w)
+}
+
+// NewDecoder return the JSON decoder reading from r
+func (JSONSnapshotCodec) NewDecoder(r io.Reader) cache.Decoder {
+	return json.NewDecoder(r)
+}
+
+// snapshotHeader is written before the items of the snapshot
+type snapshotHeader struct {
+	Version   int
+	Algorithm string
+	Count     int // total of the items following the header
+}
+
+// snapshotItem is the document with its eviction state
+type snapshotItem struct {
+	Key        string
+	Value      interface{}
+	Data       []byte // the value encoded by the codec of the cache, instead of Value
+	StoredTime int64
+	TTL        time.Duration
+	Delta      time.Duration
+	Tags       []string
+	Frequency  uint64 // the frequency of the item in LFU, zero in LRU
+	Version    uint64 // the version of the item spilled to the disk tier, zero in the snapshots
+}
+
+// persistValue encodes the value with the codec of the cache, if it's set, for the snapshots, the append only file
+// and the disk tier, so the value round-trips with its registered type. Otherwise the value is returned as is,
+// and encoded by the snapshot codec
+func (c *Cache) persistValue(value interface{}) (interface{}, []byte, error) {
+	if c.option.Codec == nil {
+		return value, nil, nil
+	}
+	data, err := MarshalValue(c.option.Codec, value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, data, nil
+}
+
+// restoreValue decodes the value persisted by persistValue
+func (c *Cache) restoreValue(value interface{}, data []byte) (interface{}, error) {
+	if data == nil {
+		return value, nil
+	}
+	if c.option.Codec == nil {
+		return nil, cache.ErrUnsupportedValue
+	}
+	return UnmarshalValue(c.option.Codec, data)
+}
+
+// Save will write the non expired items to w with the snapshot codec, in the eviction order,
+// so Load restores both the items and their recent-ness or frequency. The items in the disk tier are saved
+// first, as the oldest. The items are copied under the read lock, and encoded without holding the lock
+func (c *Cache) Save(w io.Writer) (err error) {
+	var items []snapshotItem
+	collect := func(doc *cache.Document) bool {
+		if doc.IsExpired() {
+			return true
+		}
+		items = append(items, snapshotItem{
+			Key:        doc.Key,
+			Value:      doc.Value,
+			StoredTime: doc.StoredTime,
+			TTL:        doc.TTL,
+			Delta:      doc.Delta,
+			Tags:       doc.Tags,
+			Frequency:  c.repo.Frequency(doc.Key),
+		})
+		return true
+	}
+	c.mutex.RLock()
+	c.rangeSpilled(collect)
+	c.repo.Range(collect)
+	c.mutex.RUnlock()
+
+	enc := c.option.SnapshotCodec.NewEncoder(w)
+	err = enc.Encode(snapshotHeader{
+		Version:   snapshotVersion,
+		Algorithm: c.option.AlgorithmType,
+		Count:     len(items),
+	})
+	if err != nil {
+		return
+	}
+	for i := range items {
+		if items[i].Value, items[i].Data, err = c.persistValue(items[i].Value); err != nil {
+			return
+		}
+		if err = enc.Encode(items[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Load will read the items saved by Save from r, and store them with their recent-ness or frequency.
+// The existing items with the same keys are replaced, the other items are kept.
+// The items expired since saved are skipped, and the items get new versions
+func (c *Cache) Load(r io.Reader) (err error) {
+	dec := c.option.SnapshotCodec.NewDecoder(r)
+	var header snapshotHeader
+	if err = dec.Decode(&header); err != nil {
+		return
+	}
+	if header.Version != snapshotVersion {
+		return cache.ErrSnapshotVersion
+	}
+
+	// Don't preallocate with the count from the stream, it may be corrupted
+	var items []snapshotItem
+	for i := 0; i < header.Count; i++ {
+		var item snapshotItem
+		if err = dec.Decode(&item); err != nil {
+			return
+		}
+		if item.Value, err = c.restoreValue(item.Value, item.Data); err != nil {
+			return
+		}
+		items = append(items, item)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, item := range items {
+		doc := c.newDocument(item.Key, item.Value)
+		doc.StoredTime = item.StoredTime
+		doc.TTL = item.TTL
+		doc.Delta = item.Delta
+		doc.Tags = item.Tags
+		if doc.IsExpired() {
+			continue
+		}
+		if err = c.restore(doc, item.Frequency); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// restore is the same as store, but keeps the frequency of the document. The caller must hold the lock
+func (c *Cache) restore(doc *cache.Document, frequency uint64) (err error) {
+	c.tags.add(doc)
+	if err = c.repo.SetWithFrequency(doc, frequency); err != nil {
+		c.tags.remove(doc)
+		return
+	}
+	c.dropReplaced(doc)
+	return c.logSet(doc)
+}
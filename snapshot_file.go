@@ -0,0 +1,165 @@
+package gotcha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+const (
+	// snapshotFileMagic identifies the snapshot file
+	snapshotFileMagic = "GOTCHA"
+	// snapshotFileVersion is the version of the snapshot file header
+	snapshotFileVersion uint16 = 1
+	// snapshotFileHeaderSize is the size of magic, version, payload length and checksum
+	snapshotFileHeaderSize = len(snapshotFileMagic) + 2 + 8 + 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SaveFile will save the snapshot to the file atomically. The snapshot is written to a temporary file
+// in the same directory, synced, and renamed to the path, so a crash never corrupts the previous snapshot
+func (c *Cache) SaveFile(path string) (err error) {
+	var payload bytes.Buffer
+	if err = c.Save(&payload); err != nil {
+		return
+	}
+
+	header := make([]byte, snapshotFileHeaderSize)
+	n := copy(header, snapshotFileMagic)
+	binary.BigEndian.PutUint16(header[n:], snapshotFileVersion)
+	binary.BigEndian.PutUint64(header[n+2:], uint64(payload.Len()))
+	binary.BigEndian.PutUint32(header[n+10:], crc32.Checksum(payload.Bytes(), crcTable))
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(header); err != nil {
+		return
+	}
+	if _, err = tmp.Write(payload.Bytes()); err != nil {
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return
+	}
+	syncDir(dir)
+	return
+}
+
+// syncDir persists the rename in the directory, it's not supported by every platform so the error is ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// LoadFile will load the snapshot saved by SaveFile. It returns cache.ErrSnapshotCorrupted
+// if the file is not a snapshot or fails the checksum, and keeps the cache untouched
+func (c *Cache) LoadFile(path string) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if len(data) < snapshotFileHeaderSize || string(data[:len(snapshotFileMagic)]) != snapshotFileMagic {
+		return cache.ErrSnapshotCorrupted
+	}
+	n := len(snapshotFileMagic)
+	if binary.BigEndian.Uint16(data[n:]) != snapshotFileVersion {
+		return cache.ErrSnapshotVersion
+	}
+	payload := data[snapshotFileHeaderSize:]
+	if binary.BigEndian.Uint64(data[n+2:]) != uint64(len(payload)) ||
+		binary.BigEndian.Uint32(data[n+10:]) != crc32.Checksum(payload, crcTable) {
+		return cache.ErrSnapshotCorrupted
+	}
+	return c.Load(bytes.NewReader(payload))
+}
+
+// loadSnapshot loads the snapshot file if it exists
+func (c *Cache) loadSnapshot() {
+	if c.option.SnapshotPath == "" {
+		return
+	}
+	if err := c.LoadFile(c.option.SnapshotPath); err != nil && !os.IsNotExist(err) {
+		c.snapshotError(err)
+	}
+}
+
+// startSnapshot saves the snapshot every interval until Close
+func (c *Cache) startSnapshot() {
+	if c.option.SnapshotPath == "" || c.option.SnapshotInterval <= 0 {
+		return
+	}
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		ticker := time.NewTicker(c.option.SnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.SaveFile(c.option.SnapshotPath); err != nil {
+					c.snapshotError(err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Cache) snapshotError(err error) {
+	if c.option.OnSnapshotError != nil {
+		c.option.OnSnapshotError(err)
+	}
+}
+
+// Close will stop the background snapshot and append only file, save the last snapshot if the snapshot file
+// is set, close the append only file, and remove the disk tier. The cache can still be used after closed, but it won't be saved anymore
+func (c *Cache) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		c.background.Wait()
+		if c.option.SnapshotPath != "" {
+			err = c.SaveFile(c.option.SnapshotPath)
+		}
+		if errAOF := c.aof.close(); err == nil {
+			err = errAOF
+		}
+		if c.disk != nil {
+			c.mutex.Lock()
+			errDisk := c.disk.Close()
+			c.disk = nil
+			c.mutex.Unlock()
+			if err == nil {
+				err = errDisk
+			}
+		}
+	})
+	return
+}
@@ -0,0 +1,138 @@
+package gotcha_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestSaveFileAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := gotcha.New()
+	err := c.Set("key-1", "value-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.SaveFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The temporary file is renamed to the path
+	files, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected: %v, got %v", 1, len(files))
+	}
+
+	restored := gotcha.New()
+	err = restored.LoadFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := restored.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "value-1" {
+		t.Fatalf("expected: %v, got %v", "value-1", val)
+	}
+}
+
+func TestLoadFileCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := gotcha.New()
+	err := c.Set("key-1", "value-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.SaveFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	data[len(data)-1] ^= 0xff
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New()
+	err = restored.LoadFile(path)
+	if err != cache.ErrSnapshotCorrupted {
+		t.Fatalf("expected: %v, got %v", cache.ErrSnapshotCorrupted, err)
+	}
+	// The truncated file is corrupted as well
+	err = os.WriteFile(path, data[:len(data)/2], 0600)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = restored.LoadFile(path)
+	if err != cache.ErrSnapshotCorrupted {
+		t.Fatalf("expected: %v, got %v", cache.ErrSnapshotCorrupted, err)
+	}
+	if restored.Contains("key-1") {
+		t.Fatalf("expected: %v, got %v", "not loaded", "key-1")
+	}
+}
+
+func TestSnapshotFileOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	option := gotcha.NewOption().SetSnapshotFile(path, 0).SetOnSnapshotError(func(err error) {
+		t.Errorf("expected: %v, got %v", nil, err)
+	})
+
+	// The missing file is not an error
+	c := gotcha.New(option)
+	err := c.Set("key-1", "value-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The new cache is warmed up by the snapshot
+	restored := gotcha.New(option)
+	defer restored.Close()
+	val, err := restored.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "value-1" {
+		t.Fatalf("expected: %v, got %v", "value-1", val)
+	}
+}
+
+func TestSnapshotFileInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	c := gotcha.New(gotcha.NewOption().SetSnapshotFile(path, time.Millisecond*10))
+	defer c.Close()
+	err := c.Set("key-1", "value-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		restored := gotcha.New()
+		if restored.LoadFile(path) == nil && restored.Contains("key-1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected: %v, got %v", "snapshot saved", "timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
@@ -0,0 +1,185 @@
+package gotcha_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(3))
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := c.SetWithTags(key, key, "tag")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	// key-1 is the most recently used
+	_, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Persist("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	var buf bytes.Buffer
+	err = c.Save(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New(gotcha.NewOption().SetMaxSizeItem(3))
+	err = restored.Load(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	keys, err := restored.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// From the least recently used
+	expected := []string{"key-2", "key-3", "key-1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected: %v, got %v", expected, keys)
+	}
+	ttl, err := restored.TTL("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if ttl != cache.NoExpiration {
+		t.Fatalf("expected: %v, got %v", cache.NoExpiration, ttl)
+	}
+
+	// The tags are restored
+	deleted, err := restored.InvalidateTag("tag")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != 3 {
+		t.Fatalf("expected: %v, got %v", 3, deleted)
+	}
+}
+
+func TestSaveAndLoadFrequency(t *testing.T) {
+	option := gotcha.NewOption().SetAlgorithm(cache.LFUAlgorithm).SetMaxSizeItem(3)
+	c := gotcha.New(option)
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	for _, key := range []string{"key-1", "key-1", "key-3"} {
+		_, err := c.Get(key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := c.Save(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	restored := gotcha.New(option)
+	err = restored.Load(&buf)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// key-2 is the least frequently used, so it's evicted for the new item
+	err = restored.Set("key-4", "key-4")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if restored.Contains("key-2") {
+		t.Fatalf("expected: %v, got %v", "evicted", "key-2")
+	}
+	// key-4 has the lowest frequency after the eviction
+	key, _, err := restored.PopLeastFrequent()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if key != "key-4" {
+		t.Fatalf("expected: %v, got %v", "key-4", key)
+	}
+	key, _, err = restored.PopLeastFrequent()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if key != "key-3" {
+		t.Fatalf("expected: %v, got %v", "key-3", key)
+	}
+}
+
+type snapshotUser struct {
+	Name string
+}
+
+func TestSaveAndLoadWithCodec(t *testing.T) {
+	gob.Register(snapshotUser{})
+	for name, codec := range map[string]cache.SnapshotCodec{
+		"gob":  gotcha.GobSnapshotCodec{},
+		"json": gotcha.JSONSnapshotCodec{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			option := gotcha.NewOption().SetSnapshotCodec(codec)
+			c := gotcha.New(option)
+			err := c.Set("user", snapshotUser{Name: "john"})
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			err = c.Set("expired", "expired")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			err = c.ExpireAt("expired", time.Now().Add(time.Second))
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+
+			var buf bytes.Buffer
+			err = c.Save(&buf)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			time.Sleep(time.Second * 2)
+
+			restored := gotcha.New(option)
+			err = restored.Load(&buf)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if restored.Contains("expired") {
+				t.Fatalf("expected: %v, got %v", "expired", "restored")
+			}
+			val, err := restored.Get("user")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			// JSON restores the struct as a map
+			expected := map[string]interface{}{
+				"gob":  snapshotUser{Name: "john"},
+				"json": map[string]interface{}{"Name": "john"},
+			}[name]
+			if !reflect.DeepEqual(val, expected) {
+				t.Fatalf("expected: %v, got %v", expected, val)
+			}
+		})
+	}
+}
+
+func TestLoadUnsupportedVersion(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetSnapshotCodec(gotcha.JSONSnapshotCodec{}))
+	err := c.Load(bytes.NewBufferString(`{"Version":99,"Count":0}`))
+	if err != cache.ErrSnapshotVersion {
+		t.Fatalf("expected: %v, got %v", cache.ErrSnapshotVersion, err)
+	}
+}
@@ -0,0 +1,77 @@
+package gotcha
+
+import (
+	"github.com/bxcodec/gotcha/cache"
+)
+
+// tagIndex maps each tag to the keys stored with the tag and the version of their documents.
+// It doesn't keep the documents, so the values are not retained, e.g the plaintext of the encrypted values
+type tagIndex map[string]map[string]uint64
+
+func (t tagIndex) add(doc *cache.Document) {
+	for _, tag := range doc.Tags {
+		versions, ok := t[tag]
+		if !ok {
+			versions = map[string]uint64{}
+			t[tag] = versions
+		}
+		versions[doc.Key] = doc.Version
+	}
+}
+
+// remove removes the document from its tags, only if the tags still point to this version of the document,
+// since it may be called for the document replaced by a newer one with the same key
+func (t tagIndex) remove(doc *cache.Document) {
+	for _, tag := range doc.Tags {
+		docs := t[tag]
+		if version, ok := docs[doc.Key]; !ok || version != doc.Version {
+			continue
+		}
+		delete(docs, doc.Key)
+		if len(docs) == 0 {
+			delete(t, tag)
+		}
+	}
+}
+
+// SetWithTags used for setting the item to cache with the tags, so it can be invalidated with any of the tags.
+// The tags replace the tags of the existing item
+func (c *Cache) SetWithTags(key string, value interface{}, tags ...string) (err error) {
+	document := c.newDocument(key, value)
+	document.Tags = tags
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err = c.store(document)
+	return
+}
+
+// InvalidateTag will remove all the items stored with the tag, and return the number of removed items
+func (c *Cache) InvalidateTag(tag string) (deleted int, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	keys := make([]string, 0, len(c.tags[tag]))
+	for key := range c.tags[tag] {
+		keys = append(keys, key)
+	}
+	return c.deleteKeys(keys)
+}
+
+// store will save the document to the repository, index its tags and log it to the append only file.
+// The caller must hold the lock
+func (c *Cache) store(doc *cache.Document) (err error) {
+	// Index the tags first, since the document may be evicted right away by the repository
+	c.tags.add(doc)
+	if err = c.repo.Set(doc); err != nil {
+		// The repository may reject the document without removing it
+		c.tags.remove(doc)
+		return
+	}
+	c.dropReplaced(doc)
+	return c.logSet(doc)
+}
+
+// onRemove is called by the repository when the document is deleted, evicted, expired or replaced
+func (c *Cache) onRemove(doc *cache.Document) {
+	c.tags.remove(doc)
+	c.logDelete(doc)
+}
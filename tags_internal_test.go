@@ -0,0 +1,61 @@
+package gotcha
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestTagIndexConsistency(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := New(NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(3)).(*Cache)
+			for i := 0; i < 10; i++ {
+				err := c.SetWithTags(fmt.Sprintf("key-%d", i), i, "all", fmt.Sprintf("tag-%d", i))
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			// The evicted items are removed from the index
+			if len(c.tags) != 4 || len(c.tags["all"]) != 3 {
+				t.Fatalf("expected: %v, got %v", "3 items indexed", c.tags)
+			}
+
+			// The expired items are removed from the index once the cache removes them
+			err := c.Touch("key-9", time.Nanosecond)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			_, err = c.Get("key-9")
+			if err != cache.ErrMissed {
+				t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+			}
+			if len(c.tags["all"]) != 2 || c.tags["tag-9"] != nil {
+				t.Fatalf("expected: %v, got %v", "2 items indexed", c.tags)
+			}
+
+			// The replaced item keeps only its new tags
+			err = c.SetWithTags("key-8", 8, "new")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(c.tags["all"]) != 1 || c.tags["tag-8"] != nil || len(c.tags["new"]) != 1 {
+				t.Fatalf("expected: %v, got %v", "key-8 with the new tag", c.tags)
+			}
+
+			_, _, err = c.pop(c.repo.PopOldest)
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			err = c.ClearCache()
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if len(c.tags) != 0 {
+				t.Fatalf("expected: %v, got %v", 0, len(c.tags))
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package gotcha_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func TestInvalidateTag(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(gotcha.NewOption().SetAlgorithm(algorithm))
+			items := map[string][]string{
+				"product:1":        {"product:1"},
+				"listing:shoes":    {"product:1", "product:2"},
+				"search:red-shoes": {"product:2"},
+				"listing:hats":     {"product:3"},
+			}
+			for key, tags := range items {
+				err := c.SetWithTags(key, key, tags...)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+
+			deleted, err := c.InvalidateTag("product:1")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if deleted != 2 {
+				t.Fatalf("expected: %v, got %v", 2, deleted)
+			}
+			for _, key := range []string{"product:1", "listing:shoes"} {
+				if c.Contains(key) {
+					t.Fatalf("expected: %v, got %v", "invalidated", key)
+				}
+			}
+
+			// listing:shoes is already removed, so only the search is invalidated
+			deleted, err = c.InvalidateTag("product:2")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if deleted != 1 {
+				t.Fatalf("expected: %v, got %v", 1, deleted)
+			}
+
+			// Set replaces the tags of the existing item
+			err = c.Set("listing:hats", "listing:hats")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			deleted, err = c.InvalidateTag("product:3")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if deleted != 0 || !c.Contains("listing:hats") {
+				t.Fatalf("expected: %v, got %v", "listing:hats kept", deleted)
+			}
+		})
+	}
+}
+
+func TestInvalidateTagWithUpdate(t *testing.T) {
+	c := gotcha.New()
+	err := c.SetWithTags("counter:product:1", 1, "product:1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	// The tags are kept by the update
+	_, err = c.Increment("counter:product:1", 1)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	deleted, err := c.InvalidateTag("product:1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected: %v, got %v", 1, deleted)
+	}
+}
+
+func TestInvalidateTagWithExpiredItem(t *testing.T) {
+	c := gotcha.New()
+	err := c.SetWithTags("product:1", "product:1", "product")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Touch("product:1", time.Nanosecond)
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.Get("product:1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+	deleted, err := c.InvalidateTag("product")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != 0 {
+		t.Fatalf("expected: %v, got %v", 0, deleted)
+	}
+}
@@ -0,0 +1,258 @@
+package gotcha
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/bxcodec/gotcha/cache"
+	"github.com/bxcodec/gotcha/internal/disk"
+)
+
+// diskTierCompactInterval is the interval of compacting the segments of the disk tier
+const diskTierCompactInterval = time.Second
+
+// startDiskTier opens the disk tier, and spills the evicted items to it
+func (c *Cache) startDiskTier() {
+	if c.option.DiskTierPath == "" {
+		return
+	}
+	store, err := disk.Open(c.option.DiskTierPath, int64(c.option.DiskTierSegmentSize))
+	if err != nil {
+		c.diskTierError(err)
+		return
+	}
+	store.SetMaxSize(int64(c.option.DiskTierMaxSize))
+	store.SetRemovalListener(c.dropSpilled)
+	c.disk = store
+	c.repo.SetEvictionListener(c.spill)
+
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		ticker := time.NewTicker(diskTierCompactInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.compactDiskTier()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// compactDiskTier compacts the segments of the disk tier in background instead of on the deletes,
+// since the deletes are reached by the promotion on Get. The lock is released between the segments
+func (c *Cache) compactDiskTier() {
+	for {
+		var ok bool
+		var err error
+		c.mutex.Lock()
+		if c.disk != nil {
+			ok, err = c.disk.Compact()
+		}
+		c.mutex.Unlock()
+		if err != nil {
+			c.diskTierError(err)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// spill writes the evicted document to the disk tier, or drops it once the disk tier is closed.
+// The spilled document stays in the tag index. The caller must hold the lock
+func (c *Cache) spill(doc *cache.Document) {
+	if c.disk == nil {
+		return
+	}
+	// Drop the replaced document first, so it's not left in the disk tier if the document can't be spilled
+	c.deleteSpilled(doc.Key)
+	if doc.IsExpired() {
+		return
+	}
+	doc, err := c.decodeStored(doc)
+	if err != nil {
+		c.diskTierError(err)
+		return
+	}
+	value, data, err := c.persistValue(doc.Value)
+	if err != nil {
+		c.diskTierError(err)
+		return
+	}
+	var buf bytes.Buffer
+	err = c.option.SnapshotCodec.NewEncoder(&buf).Encode(snapshotItem{
+		Key:        doc.Key,
+		Value:      value,
+		Data:       data,
+		StoredTime: doc.StoredTime,
+		TTL:        doc.TTL,
+		Delta:      doc.Delta,
+		Tags:       doc.Tags,
+		Version:    doc.Version,
+	})
+	if err == nil {
+		err = c.disk.PutWithExpiry(doc.Key, buf.Bytes(), doc.ExpiresAt())
+	}
+	if err != nil {
+		c.diskTierError(err)
+		return
+	}
+	// The removal listener logged the eviction as a delete, so the spilled item is logged again to survive the replay
+	err = c.aof.append(&aofRecord{
+		Op:         aofSet,
+		Key:        doc.Key,
+		Value:      value,
+		Data:       data,
+		StoredTime: doc.StoredTime,
+		TTL:        doc.TTL,
+		Delta:      doc.Delta,
+		Tags:       doc.Tags,
+	})
+	if err != nil {
+		c.aofError(err)
+	}
+	if len(doc.Tags) != 0 {
+		// The removal listener removed the tags
+		c.tags.add(doc)
+		c.spilled[doc.Key] = &cache.Document{Key: doc.Key, Tags: doc.Tags, Version: doc.Version}
+	}
+}
+
+// peekSpilled reads the document from the disk tier without promoting it,
+// it returns cache.ErrMissed if the document is missing. The caller must hold the lock
+func (c *Cache) peekSpilled(key string) (doc *cache.Document, err error) {
+	if c.disk == nil {
+		return nil, cache.ErrMissed
+	}
+	data, err := c.disk.Get(key)
+	if err == nil {
+		var item snapshotItem
+		if err = c.option.SnapshotCodec.NewDecoder(bytes.NewReader(data)).Decode(&item); err == nil {
+			item.Value, err = c.restoreValue(item.Value, item.Data)
+		}
+		if err == nil {
+			return &cache.Document{
+				Key:        item.Key,
+				Value:      item.Value,
+				StoredTime: item.StoredTime,
+				TTL:        item.TTL,
+				Delta:      item.Delta,
+				Tags:       item.Tags,
+				Version:    item.Version,
+			}, nil
+		}
+	}
+	if err != cache.ErrMissed {
+		c.diskTierError(err)
+	}
+	return nil, cache.ErrMissed
+}
+
+// promote moves the document from the disk tier back to the memory, keeping its version,
+// it returns cache.ErrMissed if the document is missing or expired. The caller must hold the lock
+func (c *Cache) promote(key string) (doc *cache.Document, err error) {
+	doc, err = c.peekSpilled(key)
+	if err != nil {
+		return
+	}
+	if doc.IsExpired() {
+		c.deleteSpilled(key)
+		return nil, cache.ErrMissed
+	}
+	// The document stays in the disk tier if it's rejected by the memory
+	if err = c.store(doc); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// dropReplaced deletes the replaced document from the disk tier once the document is stored,
+// since the item only lives in one tier. The document evicted right away replaced it by spilling.
+// The caller must hold the lock
+func (c *Cache) dropReplaced(doc *cache.Document) {
+	if c.disk != nil && c.repo.Contains(doc.Key) && c.deleteSpilled(doc.Key) {
+		// The promoted document has the same version as the spilled one, so its tags are removed as well
+		c.tags.add(doc)
+	}
+}
+
+// deleteSpilled deletes the document from the disk tier and the tag index. The caller must hold the lock
+func (c *Cache) deleteSpilled(key string) (ok bool) {
+	if c.disk == nil || !c.disk.Delete(key) {
+		return false
+	}
+	c.dropSpilled(key)
+	return true
+}
+
+// dropSpilled removes the tags of the document deleted from the disk tier, or dropped by the disk tier
+func (c *Cache) dropSpilled(key string) {
+	if doc, ok := c.spilled[key]; ok {
+		c.tags.remove(doc)
+		delete(c.spilled, key)
+	}
+}
+
+// get retrieves the document from the memory, or promotes it from the disk tier. The caller must hold the lock
+func (c *Cache) get(key string) (doc *cache.Document, err error) {
+	doc, err = c.repo.Get(key)
+	if err == cache.ErrMissed {
+		doc, err = c.promote(key)
+	}
+	return
+}
+
+// keysWithPrefix returns the keys with the given prefix in the memory, followed by the keys in the disk tier.
+// The caller must hold the lock
+func (c *Cache) keysWithPrefix(prefix string) (keys []string) {
+	keys = c.repo.KeysWithPrefix(prefix)
+	if c.disk != nil {
+		keys = append(keys, c.disk.KeysWithPrefix(prefix)...)
+	}
+	return
+}
+
+// rangeSpilled calls fn for each non expired document in the disk tier, in the order they're spilled,
+// until fn returns false. The caller must hold the lock
+func (c *Cache) rangeSpilled(fn func(doc *cache.Document) bool) {
+	if c.disk == nil {
+		return
+	}
+	c.disk.Range(func(key string, _ time.Time) bool {
+		doc, err := c.peekSpilled(key)
+		if err != nil || doc.IsExpired() {
+			return true
+		}
+		return fn(doc)
+	})
+}
+
+// rangeSpilledMetadata is the same as rangeSpilled without reading the documents from the disk tier,
+// so the documents only have their key. The caller must hold the lock
+func (c *Cache) rangeSpilledMetadata(fn func(doc *cache.Document) bool) {
+	if c.disk == nil {
+		return
+	}
+	c.disk.Range(func(key string, _ time.Time) bool {
+		return fn(&cache.Document{Key: key})
+	})
+}
+
+// remove deletes the item from the memory and the disk tier. The caller must hold the lock
+func (c *Cache) remove(key string) (ok bool, err error) {
+	ok, err = c.repo.Delete(key)
+	if c.deleteSpilled(key) {
+		ok = true
+	}
+	return
+}
+
+func (c *Cache) diskTierError(err error) {
+	if c.option.OnDiskTierError != nil {
+		c.option.OnDiskTierError(err)
+	}
+}
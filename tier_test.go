@@ -0,0 +1,403 @@
+package gotcha_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/gotcha"
+	"github.com/bxcodec/gotcha/cache"
+)
+
+func newDiskTierOption(t *testing.T, algorithm string) *cache.Option {
+	return gotcha.NewOption().SetAlgorithm(algorithm).SetMaxSizeItem(2).SetDiskTier(t.TempDir()).
+		SetOnDiskTierError(func(err error) {
+			t.Errorf("expected: %v, got %v", nil, err)
+		})
+}
+
+func TestDiskTier(t *testing.T) {
+	for _, algorithm := range []string{cache.LRUAlgorithm, cache.LFUAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := gotcha.New(newDiskTierOption(t, algorithm))
+			defer c.Close()
+			for _, key := range []string{"key-1", "key-2", "key-3"} {
+				err := c.Set(key, key)
+				if err != nil {
+					t.Fatalf("expected: %v, got %v", nil, err)
+				}
+			}
+			// key-1 is evicted from the memory, and still contained in the disk tier
+			if !c.Contains("key-1") {
+				t.Fatalf("expected: %v, got %v", "spilled", "key-1")
+			}
+
+			// The miss falls through to the disk tier, and promotes key-1 back to the memory
+			val, err := c.Get("key-1")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "key-1" {
+				t.Fatalf("expected: %v, got %v", "key-1", val)
+			}
+			// key-2 is evicted for the promoted key-1
+			val, err = c.Get("key-2")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+			if val != "key-2" {
+				t.Fatalf("expected: %v, got %v", "key-2", val)
+			}
+		})
+	}
+}
+
+func TestDiskTierDelete(t *testing.T) {
+	c := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm))
+	defer c.Close()
+	for _, key := range []string{"key-1", "key-2", "key-3", "key-4"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// The deleted item in the disk tier is not promoted anymore
+	err := c.Delete("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	_, err = c.Get("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+
+	// The new value replaces the value in the disk tier
+	err = c.Set("key-2", "new-value")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	val, err := c.Get("key-2")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if val != "new-value" {
+		t.Fatalf("expected: %v, got %v", "new-value", val)
+	}
+
+	err = c.ClearCache()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	for _, key := range []string{"key-1", "key-2", "key-3", "key-4"} {
+		_, err = c.Get(key)
+		if err != cache.ErrMissed {
+			t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+		}
+	}
+}
+
+func TestDiskTierClose(t *testing.T) {
+	dir := t.TempDir()
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(1).SetDiskTier(dir))
+	for _, key := range []string{"key-1", "key-2"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	err := c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(segments) != 0 {
+		t.Fatalf("expected: %v, got %v", 0, segments)
+	}
+}
+
+func TestDiskTierEvictAfterClose(t *testing.T) {
+	c := gotcha.New(gotcha.NewOption().SetMaxSizeItem(2).SetDiskTier(t.TempDir()))
+	err := c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The evicted items are dropped, since the disk tier is closed
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		err = c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	_, err = c.Get("key-1")
+	if err != cache.ErrMissed {
+		t.Fatalf("expected: %v, got %v", cache.ErrMissed, err)
+	}
+}
+
+func TestDiskTierLookup(t *testing.T) {
+	newCache := func(t *testing.T) cache.Cache {
+		c := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm))
+		t.Cleanup(func() { c.Close() })
+		// user:1 is spilled to the disk tier
+		for _, key := range []string{"user:1", "user:2", "order:1"} {
+			err := c.SetWithTags(key, int64(100), "tag")
+			if err != nil {
+				t.Fatalf("expected: %v, got %v", nil, err)
+			}
+		}
+		return c
+	}
+
+	t.Run("peek", func(t *testing.T) {
+		c := newCache(t)
+		val, err := c.Peek("user:1")
+		if err != nil || val != int64(100) {
+			t.Fatalf("expected: %v, got %v", 100, val)
+		}
+		if _, err = c.TTL("user:1"); err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	})
+
+	t.Run("get-many", func(t *testing.T) {
+		c := newCache(t)
+		values, missing := c.GetMany([]string{"user:1", "user:2"})
+		if len(values) != 2 || len(missing) != 0 {
+			t.Fatalf("expected: %v, got %v", 2, values)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		c := newCache(t)
+		err := c.Add("user:1", int64(1))
+		if err != cache.ErrExists {
+			t.Fatalf("expected: %v, got %v", cache.ErrExists, err)
+		}
+		_, version, err := c.GetWithVersion("user:1")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		// user:2 is spilled for the promoted user:1, and keeps its version
+		_, version2, err := c.GetWithVersion("user:2")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.CompareAndSwap("user:1", version, int64(1))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		err = c.CompareAndSwap("user:2", version2, int64(2))
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	})
+
+	t.Run("compute", func(t *testing.T) {
+		c := newCache(t)
+		val, err := c.Increment("user:1", 1)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != 101 {
+			t.Fatalf("expected: %v, got %v", 101, val)
+		}
+	})
+
+	t.Run("delete-by-prefix", func(t *testing.T) {
+		c := newCache(t)
+		deleted, err := c.DeleteByPrefix("user:")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if deleted != 2 {
+			t.Fatalf("expected: %v, got %v", 2, deleted)
+		}
+		if c.Contains("user:1") {
+			t.Fatalf("expected: %v, got %v", "deleted", "user:1")
+		}
+	})
+
+	t.Run("invalidate-tag", func(t *testing.T) {
+		c := newCache(t)
+		deleted, err := c.InvalidateTag("tag")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if deleted != 3 {
+			t.Fatalf("expected: %v, got %v", 3, deleted)
+		}
+		for _, key := range []string{"user:1", "user:2", "order:1"} {
+			if c.Contains(key) {
+				t.Fatalf("expected: %v, got %v", "deleted", key)
+			}
+		}
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		c := newCache(t)
+		keys, err := c.Namespace("user").GetKeys()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if len(keys) != 2 {
+			t.Fatalf("expected: %v, got %v", 2, keys)
+		}
+		err = c.Namespace("user").ClearCache()
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if c.Contains("user:1") {
+			t.Fatalf("expected: %v, got %v", "deleted", "user:1")
+		}
+	})
+}
+
+func TestDiskTierMaxSize(t *testing.T) {
+	c := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm).SetMaxSizeItem(1).
+		SetDiskTierSegmentSize(256).SetDiskTierMaxSize(1024))
+	defer c.Close()
+	for i := 0; i < 50; i++ {
+		err := c.SetWithTags(fmt.Sprintf("key-%02d", i), strings.Repeat("x", 64), "tag")
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// The oldest items are dropped from the disk tier and the tag index
+	keys, err := c.GetKeys()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(keys) >= 50 {
+		t.Fatalf("expected: %v, got %v", "less than 50", len(keys))
+	}
+	if c.Contains("key-00") {
+		t.Fatalf("expected: %v, got %v", "dropped", "key-00")
+	}
+	deleted, err := c.InvalidateTag("tag")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if deleted != len(keys) {
+		t.Fatalf("expected: %v, got %v", len(keys), deleted)
+	}
+}
+
+func TestDiskTierPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	keys := []string{"key-1", "key-2", "key-3", "key-4", "key-5"}
+	c := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm).SetExpiryTime(time.Hour).SetSnapshotFile(path, 0))
+	for _, key := range keys {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// The iterators and the expiry stats include the items in the disk tier, the oldest first
+	var iterated []string
+	for key := range c.Keys() {
+		iterated = append(iterated, key)
+	}
+	if !reflect.DeepEqual(iterated, keys) {
+		t.Fatalf("expected: %v, got %v", keys, iterated)
+	}
+	stats, err := c.ExpiryStats()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if stats.Count != len(keys) {
+		t.Fatalf("expected: %v, got %v", len(keys), stats.Count)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	// The snapshot keeps the items in the disk tier, which is removed on Close
+	restored := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm).SetSnapshotFile(path, 0))
+	defer restored.Close()
+	for _, key := range keys {
+		val, err := restored.Get(key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != key {
+			t.Fatalf("expected: %v, got %v", key, val)
+		}
+	}
+}
+
+func TestDiskTierAOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	c := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm).SetAppendOnlyFile(path, cache.AOFSyncAlways))
+	for _, key := range []string{"key-1", "key-2", "key-3", "key-4", "key-5"} {
+		err := c.Set(key, key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+	// Both the log and the rewritten file keep the items spilled to the disk tier
+	err := c.Set("key-6", "key-6")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.RewriteAOF()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Set("key-7", "key-7")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+
+	restored := gotcha.New(newDiskTierOption(t, cache.LRUAlgorithm).SetAppendOnlyFile(path, cache.AOFSyncAlways))
+	defer restored.Close()
+	for _, key := range []string{"key-1", "key-2", "key-3", "key-4", "key-5", "key-6", "key-7"} {
+		val, err := restored.Get(key)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+		if val != key {
+			t.Fatalf("expected: %v, got %v", key, val)
+		}
+	}
+}
+
+func TestDiskTierRejectedWrite(t *testing.T) {
+	c := gotcha.New(newDiskTierOption(t, cache.ArenaAlgorithm).SetMaxMemory(cache.KB))
+	defer c.Close()
+	value := make([]byte, 600)
+	for _, key := range []string{"key-1", "key-2"} {
+		err := c.Set(key, value)
+		if err != nil {
+			t.Fatalf("expected: %v, got %v", nil, err)
+		}
+	}
+
+	// The rejected write keeps the item in the disk tier
+	err := c.Set("key-1", "value")
+	if err != cache.ErrUnsupportedValue {
+		t.Fatalf("expected: %v, got %v", cache.ErrUnsupportedValue, err)
+	}
+	val, err := c.Get("key-1")
+	if err != nil {
+		t.Fatalf("expected: %v, got %v", nil, err)
+	}
+	if len(val.([]byte)) != len(value) {
+		t.Fatalf("expected: %v, got %v", len(value), len(val.([]byte)))
+	}
+}